@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func userFromDB(user database.User) User {
+	return User{
+		ID:           user.ID,
+		CreatedAt:    user.CreatedAt,
+		UdpatedAt:    user.UpdatedAt,
+		Email:        user.Email,
+		Username:     user.Username.String,
+		Verified:     user.EmailVerifiedAt.Valid,
+		PendingEmail: user.PendingEmail.String,
+		TOTPEnabled:  user.TotpEnabledAt.Valid,
+		IsChirpyRed:  user.IsChirpyRed,
+	}
+}
+
+func emailTaken(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key"
+}
+
+// userAccountChanges are the changes to the account of a user, nil fields
+// are kept.
+type userAccountChanges struct {
+	Email           *string `json:"email"`
+	Password        *string `json:"password"`
+	Username        *string `json:"username"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+// userPatchHandler updates only the fields given.
+func (cfg *apiConfig) userPatchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, sessionID, err := cfg.authenticateSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	params := userAccountChanges{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	cfg.userAccountUpdate(w, r, userID, sessionID, params)
+}
+
+// userAccountUpdate makes the changes to the account of the user, logged in
+// with the session. Changing the email or the password takes the current
+// password as well, a stolen access token alone isn't enough to take over
+// the account.
+func (cfg *apiConfig) userAccountUpdate(w http.ResponseWriter, r *http.Request, userID, sessionID uuid.UUID, params userAccountChanges) {
+	var err error
+	sensitive := params.Email != nil || params.Password != nil
+	user := database.User{}
+	if sensitive {
+		user, err = cfg.dbQueries.GetUserByID(context.Background(), userID)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Authorization failed: user not found", err)
+			return
+		}
+	}
+
+	updateParams := database.UpdateUserAccountParams{ID: userID}
+	errs := validationErrors{}
+	if params.Email != nil {
+		email, err := emailParam(*params.Email)
+		errs.add("email", err)
+		updateParams.Email = sql.NullString{String: email, Valid: err == nil}
+	}
+	if params.Password != nil {
+		// the password can't be the email it's going to be used with
+		email := user.Email
+		if params.Email != nil {
+			email = *params.Email
+		}
+		errs.add("password", cfg.passwordParam(*params.Password, email))
+	}
+	if params.Username != nil {
+		username, err := usernameParam(*params.Username)
+		if err == nil && !username.Valid {
+			err = errors.New("username can't be removed")
+		}
+		errs.add("username", err)
+		updateParams.Username = username
+	}
+	if sensitive && params.CurrentPassword == "" {
+		errs.add("current_password", errors.New("current_password is required to change the email or password"))
+	}
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	if sensitive && !cfg.currentPasswordCheck(w, r, user, params.CurrentPassword) {
+		return
+	}
+
+	if params.Password != nil {
+		passwordHashed, err := cfg.passwords.Hash(*params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error hashing password", err)
+			return
+		}
+		updateParams.HashedPassword = sql.NullString{String: passwordHashed, Valid: true}
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	user, err = qtx.UpdateUserAccount(context.Background(), updateParams)
+	if usernameTaken(err) {
+		respondWithError(w, http.StatusConflict, "Username is already taken", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating user", err)
+		return
+	}
+
+	// whoever else may know the old password is logged out, like after a
+	// reset, only the session making the change stays
+	if params.Password != nil {
+		err = qtx.RevokeUserRefreshTokensExcept(context.Background(), database.RevokeUserRefreshTokensExceptParams{
+			UserID:   userID,
+			FamilyID: sessionID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error updating user", err)
+			return
+		}
+		err = securityEventLog(qtx, userID, securityEventPasswordChanged,
+			fmt.Sprintf("password changed from %s, logged out the other sessions", clientIP(r)))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error updating user", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating user", err)
+		return
+	}
+
+	// a new email stays pending until it is verified
+	err = cfg.userEmailChanged(user, updateParams.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error sending the verification email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userFromDB(user))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestUserAccountUpdate(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	const passwordNew = "x7#kP9!qL2@m"
+
+	cases := map[string]struct {
+		method     string
+		path       string
+		body       any
+		noToken    bool
+		wantCode   int
+		wantFields []string
+	}{
+		"username": {
+			method:   "PATCH",
+			path:     "/api/users/me",
+			body:     map[string]string{"username": "otter_fan"},
+			wantCode: http.StatusOK,
+		},
+		"username removed": {
+			method:     "PATCH",
+			path:       "/api/users/me",
+			body:       map[string]string{"username": ""},
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"username"},
+		},
+		"email without current password": {
+			method:     "PATCH",
+			path:       "/api/users/me",
+			body:       map[string]string{"email": "otter@example.com"},
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"current_password"},
+		},
+		"invalid email and password": {
+			method:     "PATCH",
+			path:       "/api/users/me",
+			body:       map[string]string{"email": "otter", "password": "short", "current_password": testPassword},
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"email", "password"},
+		},
+		"wrong current password": {
+			method:   "PATCH",
+			path:     "/api/users/me",
+			body:     map[string]string{"password": passwordNew, "current_password": "not-the-password-1"},
+			wantCode: http.StatusForbidden,
+		},
+		"password": {
+			method:   "PATCH",
+			path:     "/api/users/me",
+			body:     map[string]string{"password": passwordNew, "current_password": testPassword},
+			wantCode: http.StatusOK,
+		},
+		"no token": {
+			method:   "PATCH",
+			path:     "/api/users/me",
+			body:     map[string]string{"username": "otter_foe"},
+			noToken:  true,
+			wantCode: http.StatusUnauthorized,
+		},
+		"replaced without current password": {
+			method:     "PUT",
+			path:       "/api/users",
+			body:       map[string]string{"email": "otter@example.com", "password": passwordNew},
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"current_password"},
+		},
+		"replaced": {
+			method:   "PUT",
+			path:     "/api/users",
+			body:     map[string]string{"email": "otter@example.com", "password": passwordNew, "current_password": testPassword},
+			wantCode: http.StatusOK,
+		},
+		"replaced with a broken body": {
+			method:   "PUT",
+			path:     "/api/users",
+			body:     "otter",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			user := api.login(t, api.userCreate(t), testPassword)
+			authorization := bearer(user.Token)
+			if c.noToken {
+				authorization = ""
+			}
+
+			res := api.request(t, c.method, c.path, authorization, c.body)
+			if res.code != c.wantCode {
+				t.Fatalf("%s %s got %d %s, want %d", c.method, c.path, res.code, res.body, c.wantCode)
+			}
+			if c.wantFields != nil {
+				fields := slices.Sorted(maps.Keys(res.fields(t)))
+				if !reflect.DeepEqual(fields, c.wantFields) {
+					t.Errorf("%s %s failed validation of %v, want %v", c.method, c.path, fields, c.wantFields)
+				}
+			}
+		})
+	}
+}
+
+func TestUserPasswordChange(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	const passwordNew = "x7#kP9!qL2@m"
+
+	email := api.userCreate(t)
+	user := api.login(t, email, testPassword)
+	userElsewhere := api.login(t, email, testPassword)
+
+	res := api.request(t, "PATCH", "/api/users/me", bearer(user.Token),
+		map[string]string{"password": passwordNew, "current_password": testPassword})
+	if res.code != http.StatusOK {
+		t.Fatalf("PATCH /api/users/me got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+
+	res = api.request(t, "POST", "/api/refresh", bearer(userElsewhere.TokenRefresh), nil)
+	if res.code != http.StatusUnauthorized {
+		t.Errorf("refresh of the other session got %d, want it logged out with %d", res.code, http.StatusUnauthorized)
+	}
+	res = api.request(t, "POST", "/api/refresh", bearer(user.TokenRefresh), nil)
+	if res.code != http.StatusOK {
+		t.Errorf("refresh of the session changing the password got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+
+	res = api.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": testPassword})
+	if res.code != http.StatusUnauthorized {
+		t.Errorf("login with the old password got %d, want %d", res.code, http.StatusUnauthorized)
+	}
+	api.login(t, email, passwordNew)
+
+	if got := api.securityEvents(t, user.ID, securityEventPasswordChanged); got != 1 {
+		t.Errorf("got %d %s security events, want 1", got, securityEventPasswordChanged)
+	}
+}
@@ -2,81 +2,389 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/chirptext"
 	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/el-damiano/bootdev-http-server/internal/mail"
+	"github.com/el-damiano/bootdev-http-server/internal/media"
+	"github.com/el-damiano/bootdev-http-server/internal/moderation"
+	"github.com/el-damiano/bootdev-http-server/internal/throttle"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type apiConfig struct {
 	platform       string
-	tokenSecret    string
-	polkaKey       string
-	dbQueries      *database.Queries
-	fileserverHits atomic.Int32
+	keyRing        *auth.KeyRing
+	passwords      *auth.Passwords
+	passwordPolicy auth.PasswordPolicy
+	// secrets seals the secrets kept in the database the server has to
+	// read back, like signing keys.
+	secrets *auth.SecretBox
+
+	loginAccountThrottle *throttle.Limiter
+	loginIPThrottle      *throttle.Limiter
+	polkaKey             string
+	adminKey             string
+	db                   *sql.DB
+	dbQueries            *database.Queries
+	contentFilter        *moderation.WordList
+	blobStore            media.BlobStore
+	mailer               mail.Mailer
+	fileserverHits       atomic.Int32
+
+	signingAlgorithm     string
+	requireVerifiedEmail bool
+
+	// clock decides what has expired, time.Now if nil.
+	clock func() time.Time
+}
+
+func (cfg *apiConfig) now() time.Time {
+	if cfg.clock != nil {
+		return cfg.clock()
+	}
+	return time.Now()
 }
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         uuid.UUID      `json:"id"`
+	Body       string         `json:"body"`
+	UserID     uuid.UUID      `json:"user_id"`
+	ParentID   *uuid.UUID     `json:"parent_id"`
+	RootID     *uuid.UUID     `json:"root_id"`
+	ReplyCount int32          `json:"reply_count"`
+	LikeCount  int32          `json:"like_count"`
+	LikedByMe  *bool          `json:"liked_by_me,omitempty"`
+	Kind       string         `json:"kind"`
+	Original   *ChirpOriginal `json:"original,omitempty"`
+	Mentions   []Mention      `json:"mentions"`
+	Media      []Media        `json:"media"`
+	Deleted    bool           `json:"deleted,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+const (
+	chirpKindChirp   = "chirp"
+	chirpKindRechirp = "rechirp"
+	chirpKindQuote   = "quote"
+)
+
+// ChirpOriginal is the chirp embedded in a rechirp or a quote. Once the
+// original is deleted only the unavailable placeholder is left.
+type ChirpOriginal struct {
+	*Chirp
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+type ChirpsPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+func chirpFromDB(chirp database.Chirp) Chirp {
+	return Chirp{
+		ID:         chirp.ID,
+		Body:       chirp.Body,
+		UserID:     chirp.UserID,
+		ParentID:   nullUUIDPtr(chirp.ParentID),
+		RootID:     nullUUIDPtr(chirp.RootID),
+		ReplyCount: chirp.ReplyCount,
+		LikeCount:  chirp.LikeCount,
+		Kind:       chirp.Kind,
+		Mentions:   []Mention{},
+		Media:      []Media{},
+		Deleted:    chirp.DeletedAt.Valid,
+		CreatedAt:  chirp.CreatedAt,
+		UpdatedAt:  chirp.UpdatedAt,
+	}
+}
+
+// chirpsResponse converts chirps for a response, filling in what is specific
+// to the viewer when the request came from a logged in user.
+func (cfg *apiConfig) chirpsResponse(chirps []database.Chirp, viewerID uuid.NullUUID) ([]Chirp, error) {
+	chirpsResponse := make([]Chirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpsResponse = append(chirpsResponse, chirpFromDB(chirp))
+	}
+
+	err := cfg.chirpsEmbedOriginals(chirps, chirpsResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.chirpsEmbedMentions(chirpsResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.chirpsEmbedMedia(chirpsResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	if !viewerID.Valid || len(chirps) == 0 {
+		return chirpsResponse, nil
+	}
+
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	likedIDs, err := cfg.dbQueries.GetLikedChirpIDs(context.Background(), database.GetLikedChirpIDsParams{
+		UserID:   viewerID.UUID,
+		ChirpIds: chirpIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	liked := make(map[uuid.UUID]struct{}, len(likedIDs))
+	for _, id := range likedIDs {
+		liked[id] = struct{}{}
+	}
+
+	for i := range chirpsResponse {
+		_, ok := liked[chirpsResponse[i].ID]
+		chirpsResponse[i].LikedByMe = &ok
+	}
+	return chirpsResponse, nil
+}
+
+func (cfg *apiConfig) chirpsEmbedOriginals(chirps []database.Chirp, chirpsResponse []Chirp) error {
+	originalIDs := []uuid.UUID{}
+	for _, chirp := range chirps {
+		if chirp.OriginalID.Valid {
+			originalIDs = append(originalIDs, chirp.OriginalID.UUID)
+		}
+	}
+
+	originals := map[uuid.UUID]database.Chirp{}
+	if len(originalIDs) > 0 {
+		originalsDB, err := cfg.dbQueries.GetChirpsByIDs(context.Background(), originalIDs)
+		if err != nil {
+			return err
+		}
+		for _, original := range originalsDB {
+			originals[original.ID] = original
+		}
+	}
+
+	for i, chirp := range chirps {
+		if chirp.Kind == chirpKindChirp {
+			continue
+		}
+		original, ok := originals[chirp.OriginalID.UUID]
+		if !chirp.OriginalID.Valid || !ok || original.DeletedAt.Valid {
+			chirpsResponse[i].Original = &ChirpOriginal{Unavailable: true}
+			continue
+		}
+		originalResponse := chirpFromDB(original)
+		chirpsResponse[i].Original = &ChirpOriginal{Chirp: &originalResponse}
+	}
+	return nil
+}
+
+// chirpsByID points at every chirp of a response by ID, including the
+// originals embedded in rechirps and quotes. A chirp can appear more than once.
+func chirpsByID(chirpsResponse []Chirp) map[uuid.UUID][]*Chirp {
+	chirps := map[uuid.UUID][]*Chirp{}
+	for i := range chirpsResponse {
+		chirp := &chirpsResponse[i]
+		chirps[chirp.ID] = append(chirps[chirp.ID], chirp)
+		if chirp.Original != nil && chirp.Original.Chirp != nil {
+			chirps[chirp.Original.ID] = append(chirps[chirp.Original.ID], chirp.Original.Chirp)
+		}
+	}
+	return chirps
+}
+
+func (cfg *apiConfig) chirpResponse(chirp database.Chirp, viewerID uuid.NullUUID) (Chirp, error) {
+	chirps, err := cfg.chirpsResponse([]database.Chirp{chirp}, viewerID)
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirps[0], nil
+}
+
+// chirpRespond answers with a chirp as seen by the user who just changed it.
+func (cfg *apiConfig) chirpRespond(w http.ResponseWriter, code int, chirpDB database.Chirp, userID uuid.UUID) {
+	chirp, err := cfg.chirpResponse(chirpDB, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Getting chirp failed", err)
+		return
+	}
+	respondWithJSON(w, code, chirp)
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
 }
 
 func (cfg *apiConfig) chirpCreateHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body      string      `json:"body"`
+		InReplyTo *uuid.UUID  `json:"in_reply_to"`
+		QuoteOf   *uuid.UUID  `json:"quote_of"`
+		MediaIDs  []uuid.UUID `json:"media_ids"`
+	}
+
 	decoder := json.NewDecoder(r.Body)
-	chirp := Chirp{}
+	chirp := parameters{}
 	err := decoder.Decode(&chirp)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Decoding chirp failed", err)
 		return
 	}
 
-	tokenBearer, err := auth.BearerToken(r.Header)
+	userID, err := cfg.authenticate(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Authorization failed: %v", err), err)
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(tokenBearer, cfg.tokenSecret)
+	author, err := cfg.dbQueries.GetUserByID(context.Background(), userID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: user not found", err)
+		return
+	}
+	if cfg.requireVerifiedEmail && !author.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Verify your email before posting", nil)
 		return
 	}
 
-	chirpClean, err := chirpValidate(chirp.Body)
+	chirpChecked, err := chirpValidate(chirp.Body, chirpLenMaxOf(author), cfg.contentFilter)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		respondWithChirpInvalid(w, err)
+		return
+	}
+
+	if len(chirp.MediaIDs) > chirpMediaMax {
+		respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("A chirp can have up to %d media", chirpMediaMax), nil)
+		return
 	}
 
 	chirpParams := database.CreateChirpParams{
-		Body:   chirpClean,
+		Body:   chirpChecked.Body,
 		UserID: userID,
+		Kind:   chirpKindChirp,
 	}
 
-	chirpDB, err := cfg.dbQueries.CreateChirp(context.Background(), chirpParams)
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Saving chirp failed", err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:        chirpDB.ID,
-		Body:      chirpDB.Body,
-		UserID:    chirpDB.UserID,
-		CreatedAt: chirpDB.CreatedAt,
-		UpdatedAt: chirpDB.UpdatedAt,
-	})
+	if chirp.InReplyTo != nil {
+		parent, err := chirpTarget(qtx, *chirp.InReplyTo)
+		if err != nil {
+			respondWithError(w, http.StatusUnprocessableEntity, "The chirp being replied to doesn't exist", err)
+			return
+		}
+
+		rootID := parent.RootID
+		if !rootID.Valid {
+			rootID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+		chirpParams.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		chirpParams.RootID = rootID
+
+		err = qtx.IncrementChirpReplyCount(context.Background(), parent.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Saving chirp failed", err)
+			return
+		}
+	}
+
+	if chirp.QuoteOf != nil {
+		original, err := chirpTarget(qtx, *chirp.QuoteOf)
+		if err != nil {
+			respondWithError(w, http.StatusUnprocessableEntity, "The chirp being quoted doesn't exist", err)
+			return
+		}
+		chirpParams.Kind = chirpKindQuote
+		chirpParams.OriginalID = uuid.NullUUID{UUID: original.ID, Valid: true}
+	}
+
+	chirpDB, err := qtx.CreateChirp(context.Background(), chirpParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Saving chirp failed", err)
+		return
+	}
+
+	err = chirpSyncHashtags(qtx, chirpDB)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Saving chirp hashtags failed", err)
+		return
+	}
+
+	err = chirpSyncMentions(qtx, chirpDB)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Saving chirp mentions failed", err)
+		return
+	}
+
+	err = chirpSyncFlag(qtx, chirpDB, chirpChecked.Flagged)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Saving chirp failed", err)
+		return
+	}
+
+	err = chirpAttachMedia(qtx, chirpDB, chirp.MediaIDs)
+	if errors.Is(err, errMediaUnavailable) {
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Saving chirp media failed", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Saving chirp failed", err)
+		return
+	}
+
+	cfg.chirpRespond(w, http.StatusCreated, chirpDB, userID)
+}
+
+// chirpTarget locks the chirp being replied to, quoted or rechirped. A
+// rechirp stands in for its original, so the original is returned instead.
+func chirpTarget(qtx *database.Queries, chirpID uuid.UUID) (database.Chirp, error) {
+	target, err := qtx.GetChirpByIDForUpdate(context.Background(), chirpID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if target.Kind == chirpKindRechirp {
+		if !target.OriginalID.Valid {
+			return database.Chirp{}, errors.New("rechirped chirp is unavailable")
+		}
+		target, err = qtx.GetChirpByIDForUpdate(context.Background(), target.OriginalID.UUID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+	if target.DeletedAt.Valid {
+		return database.Chirp{}, errors.New("chirp is deleted")
+	}
+	return target, nil
 }
 
 func (cfg *apiConfig) chirpsHandler(w http.ResponseWriter, r *http.Request) {
@@ -86,56 +394,94 @@ func (cfg *apiConfig) chirpsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	sortDesc := false
+	switch r.URL.Query().Get("sort") { // by default chirps are sorted by asc
+	case "", "asc":
+	case "desc":
+		sortDesc = true
+	default:
+		respondWithError(w, http.StatusBadRequest, "sort must be either 'asc' or 'desc'", nil)
+		return
+	}
+
 	var chirps []database.Chirp
-	var err error
 
 	authorIDString := r.URL.Query().Get("author_id")
 	if authorIDString != "" {
 		var authorID uuid.UUID
 		authorID, err = uuid.Parse(authorIDString)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Invalid author_id", err)
+			respondWithError(w, http.StatusBadRequest, "Invalid author_id", err)
 			return
 		}
-		chirps, err = cfg.dbQueries.GetUsersChirps(context.Background(), authorID)
+		chirps, err = cfg.usersChirpsPage(authorID, page, sortDesc)
 	} else {
-		chirps, err = cfg.dbQueries.GetAllChirps(context.Background())
+		chirps, err = cfg.chirpsPage(page, sortDesc)
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the chirps", err)
+		return
 	}
 
+	chirps, nextCursor := pageTrim(chirps, page, chirpCursor)
+
+	chirpsResponse, err := cfg.chirpsResponse(chirps, cfg.viewer(r))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error retrieving all the chirps", err)
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the chirps", err)
 		return
 	}
 
-	sortOrder := r.URL.Query().Get("sort") // by default chirps are sorted by asc
-	if sortOrder == "desc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
+	respondWithJSON(w, http.StatusOK, ChirpsPage{
+		Chirps:     chirpsResponse,
+		NextCursor: nextCursor,
+	})
+}
+
+func (cfg *apiConfig) chirpsPage(page pageRequest, sortDesc bool) ([]database.Chirp, error) {
+	if sortDesc {
+		return cfg.dbQueries.GetChirpsPageDesc(context.Background(), database.GetChirpsPageDescParams{
+			CursorCreatedAt: page.cursorCreatedAt(),
+			CursorID:        page.cursorID(),
+			PageLimit:       page.fetchLimit(),
 		})
 	}
+	return cfg.dbQueries.GetChirpsPageAsc(context.Background(), database.GetChirpsPageAscParams{
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+}
 
-	var chirpsResponse []Chirp
-	for _, chirp := range chirps {
-		chirpy := Chirp{
-			ID:        chirp.ID,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-		}
-		chirpsResponse = append(chirpsResponse, chirpy)
+func (cfg *apiConfig) usersChirpsPage(authorID uuid.UUID, page pageRequest, sortDesc bool) ([]database.Chirp, error) {
+	if sortDesc {
+		return cfg.dbQueries.GetUsersChirpsPageDesc(context.Background(), database.GetUsersChirpsPageDescParams{
+			UserID:          authorID,
+			CursorCreatedAt: page.cursorCreatedAt(),
+			CursorID:        page.cursorID(),
+			PageLimit:       page.fetchLimit(),
+		})
 	}
+	return cfg.dbQueries.GetUsersChirpsPageAsc(context.Background(), database.GetUsersChirpsPageAscParams{
+		UserID:          authorID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+}
 
-	respondWithJSON(w, http.StatusOK, chirpsResponse)
+func chirpCursor(chirp database.Chirp) pageCursor {
+	return pageCursor{CreatedAt: chirp.CreatedAt, ID: chirp.ID}
 }
 
 func (cfg *apiConfig) chirpsDeleteHandler(w http.ResponseWriter, r *http.Request) {
-	tokenBearer, err := auth.BearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(tokenBearer, cfg.tokenSecret)
+	userID, err := cfg.authenticate(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
 		return
@@ -148,8 +494,16 @@ func (cfg *apiConfig) chirpsDeleteHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	chirpDB, err := cfg.dbQueries.GetChirpByID(context.Background(), chirpID)
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
 	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Deleting chirp failed", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	chirpDB, err := qtx.GetChirpByIDForUpdate(context.Background(), chirpID)
+	if err != nil || chirpDB.DeletedAt.Valid {
 		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
 		return
 	}
@@ -158,62 +512,324 @@ func (cfg *apiConfig) chirpsDeleteHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = cfg.dbQueries.DeleteChirpByID(context.Background(), chirpDB.ID)
+	attachments, err := qtx.GetChirpsMedia(context.Background(), []uuid.UUID{chirpDB.ID})
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Deleting chirp failed", err)
+		respondWithError(w, http.StatusInternalServerError, "Deleting chirp failed", err)
 		return
 	}
 
+	err = cfg.chirpDelete(qtx, chirpDB)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Deleting chirp failed", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Deleting chirp failed", err)
+		return
+	}
+
+	for _, attachment := range attachments {
+		cfg.mediaDeleteBlobs(attachment.BlobKey, attachment.ThumbnailKey)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (cfg *apiConfig) chirpWriteByID(w http.ResponseWriter, r *http.Request, id string) {
-	_ = r
+// chirpDelete removes a chirp. Chirps that have been replied to are turned
+// into tombstones instead, so the rest of the conversation stays reachable.
+// Tombstones left without replies go too.
+func (cfg *apiConfig) chirpDelete(qtx *database.Queries, chirpDB database.Chirp) error {
+	hasReplies, err := qtx.ChirpHasReplies(context.Background(), chirpDB.ID)
+	if err != nil {
+		return err
+	}
+	if hasReplies {
+		return chirpTombstone(qtx, chirpDB.ID)
+	}
 
-	uuid, err := uuid.Parse(id)
+	for {
+		err = qtx.DeleteChirpByID(context.Background(), chirpDB.ID)
+		if err != nil {
+			return err
+		}
+		if !chirpDB.ParentID.Valid {
+			return nil
+		}
+
+		// tombstones still count as replies, only a chirp gone for good
+		// doesn't
+		err = qtx.DecrementChirpReplyCount(context.Background(), chirpDB.ParentID.UUID)
+		if err != nil {
+			return err
+		}
+
+		parent, err := qtx.GetChirpByIDForUpdate(context.Background(), chirpDB.ParentID.UUID)
+		if err != nil {
+			return err
+		}
+		if !parent.DeletedAt.Valid {
+			return nil
+		}
+		hasReplies, err = qtx.ChirpHasReplies(context.Background(), parent.ID)
+		if err != nil || hasReplies {
+			return err
+		}
+		chirpDB = parent
+	}
+}
+
+// chirpTombstone empties a chirp, keeping only its place in the conversation.
+func chirpTombstone(qtx *database.Queries, chirpID uuid.UUID) error {
+	err := qtx.DeleteChirpRevisions(context.Background(), chirpID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return err
+	}
+	err = qtx.DeleteChirpHashtags(context.Background(), chirpID)
+	if err != nil {
+		return err
+	}
+	err = qtx.DeleteChirpMentions(context.Background(), chirpID)
+	if err != nil {
+		return err
+	}
+	err = qtx.DeleteChirpFlag(context.Background(), chirpID)
+	if err != nil {
+		return err
+	}
+	err = qtx.DeleteChirpMedia(context.Background(), chirpID)
+	if err != nil {
+		return err
+	}
+	return qtx.TombstoneChirp(context.Background(), chirpID)
+}
+
+func (cfg *apiConfig) chirpUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
 		return
 	}
-	chirpDB, err := cfg.dbQueries.GetChirpByID(context.Background(), uuid)
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	chirp := Chirp{}
+	err = decoder.Decode(&chirp)
 	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Decoding chirp failed", err)
+		return
+	}
+
+	lenMax, err := cfg.chirpLenMaxFor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: user not found", err)
+		return
+	}
+
+	chirpChecked, err := chirpValidate(chirp.Body, lenMax, cfg.contentFilter)
+	if err != nil {
+		respondWithChirpInvalid(w, err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Updating chirp failed", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	chirpDB, err := qtx.GetChirpByIDForUpdate(context.Background(), chirpID)
+	if err != nil || chirpDB.DeletedAt.Valid {
 		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
 		return
 	}
+	if userID != chirpDB.UserID {
+		respondWithError(w, http.StatusForbidden, "Authorization error: insufficient permissions to edit chirp", nil)
+		return
+	}
+	if chirpDB.Kind == chirpKindRechirp {
+		respondWithError(w, http.StatusUnprocessableEntity, "Rechirps have no body to edit", nil)
+		return
+	}
+	if chirpDB.Body == chirpChecked.Body {
+		cfg.chirpRespond(w, http.StatusOK, chirpDB, userID)
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, Chirp{
-		ID:        chirpDB.ID,
+	// the revision keeps the body being replaced, dated from when it was written
+	_, err = qtx.CreateChirpRevision(context.Background(), database.CreateChirpRevisionParams{
+		ChirpID:   chirpDB.ID,
 		Body:      chirpDB.Body,
-		UpdatedAt: chirpDB.UpdatedAt,
-		CreatedAt: chirpDB.CreatedAt,
-		UserID:    chirpDB.UserID,
+		CreatedAt: chirpDB.UpdatedAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Saving chirp revision failed", err)
+		return
+	}
+
+	chirpDB, err = qtx.UpdateChirpBody(context.Background(), database.UpdateChirpBodyParams{
+		Body: chirpChecked.Body,
+		ID:   chirpDB.ID,
 	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Updating chirp failed", err)
+		return
+	}
+
+	err = chirpSyncHashtags(qtx, chirpDB)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Updating chirp hashtags failed", err)
+		return
+	}
+
+	err = chirpSyncMentions(qtx, chirpDB)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Updating chirp mentions failed", err)
+		return
+	}
+
+	err = chirpSyncFlag(qtx, chirpDB, chirpChecked.Flagged)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Updating chirp failed", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Updating chirp failed", err)
+		return
+	}
+
+	cfg.chirpRespond(w, http.StatusOK, chirpDB, userID)
 }
 
-func chirpValidate(bodyOriginal string) (string, error) {
-	const chirpLenMax = 140
-	if len(bodyOriginal) > chirpLenMax {
-		return "", errors.New("Chirp is too long")
+func (cfg *apiConfig) chirpRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
 	}
 
-	profanities := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+	_, err = cfg.dbQueries.GetChirpByID(context.Background(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
 	}
 
-	words := strings.Split(bodyOriginal, " ")
-	for i, word := range words {
-		_, ok := profanities[strings.ToLower(word)]
-		if ok {
-			words[i] = "****"
-		} else {
-			words[i] = word
-		}
+	replies, err := cfg.dbQueries.GetChirpRepliesPage(context.Background(), database.GetChirpRepliesPageParams{
+		ParentID:        chirpID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving replies", err)
+		return
 	}
 
-	bodyClean := strings.Join(words, " ")
-	return bodyClean, nil
+	replies, nextCursor := pageTrim(replies, page, chirpCursor)
+
+	repliesResponse, err := cfg.chirpsResponse(replies, cfg.viewer(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving replies", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpsPage{
+		Chirps:     repliesResponse,
+		NextCursor: nextCursor,
+	})
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	ChirpID    uuid.UUID `json:"chirp_id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+func (cfg *apiConfig) chirpRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+
+	_, err = cfg.dbQueries.GetChirpByID(context.Background(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+
+	revisions, err := cfg.dbQueries.GetChirpRevisions(context.Background(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving chirp revisions", err)
+		return
+	}
+
+	revisionsResponse := make([]ChirpRevision, 0, len(revisions))
+	for _, revision := range revisions {
+		revisionsResponse = append(revisionsResponse, ChirpRevision{
+			ID:         revision.ID,
+			ChirpID:    revision.ChirpID,
+			Body:       revision.Body,
+			CreatedAt:  revision.CreatedAt,
+			ReplacedAt: revision.ReplacedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, revisionsResponse)
+}
+
+func (cfg *apiConfig) chirpWriteByID(w http.ResponseWriter, r *http.Request, id string) {
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+	chirpDB, err := cfg.dbQueries.GetChirpByID(context.Background(), uuid)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+
+	chirp, err := cfg.chirpResponse(chirpDB, cfg.viewer(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Getting chirp failed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirp)
+}
+
+// chirpValidate checks the length of a chirp and runs it through the content
+// filter. The result holds the body to save.
+func chirpValidate(bodyOriginal string, lenMax int, filter moderation.ContentFilter) (moderation.Result, error) {
+	length := chirptext.Length(bodyOriginal)
+	if length > lenMax {
+		return moderation.Result{}, &chirpLengthError{Length: length, MaxLength: lenMax}
+	}
+
+	result := filter.Check(bodyOriginal)
+	if len(result.Rejected) > 0 {
+		return moderation.Result{}, errors.New("Chirp contains words that aren't allowed")
+	}
+	return result, nil
 }
 
 type User struct {
@@ -221,18 +837,43 @@ type User struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UdpatedAt    time.Time `json:"updated_at"`
 	Email        string    `json:"email"`
+	Username     string    `json:"username,omitempty"`
+	Verified     bool      `json:"email_verified"`
+	PendingEmail string    `json:"pending_email,omitempty"`
+	TOTPEnabled  bool      `json:"totp_enabled"`
 	Password     string    `json:"-"`
-	Token        string    `json:"token"`
-	TokenRefresh string    `json:"refresh_token"`
+	Token        string    `json:"token,omitempty"`
+	TokenRefresh string    `json:"refresh_token,omitempty"`
 	IsChirpyRed  bool      `json:"is_chirpy_red"`
 }
 
+// usernameParam validates an optional username, "" means none was given.
+func usernameParam(username string) (sql.NullString, error) {
+	if username == "" {
+		return sql.NullString{}, nil
+	}
+	if !chirptext.ValidUsername(username) {
+		return sql.NullString{}, errors.New("username must be 1 to 15 letters, digits or underscores")
+	}
+	// /api/users/me is taken by the endpoints of the logged in user
+	if strings.EqualFold(username, "me") {
+		return sql.NullString{}, errors.New("username is reserved")
+	}
+	return sql.NullString{String: username, Valid: true}, nil
+}
+
+func usernameTaken(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_username_idx"
+}
+
 func (cfg *apiConfig) userCreateHandler(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 
 	type ReqValues struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Username string `json:"username"`
 	}
 
 	reqValues := ReqValues{}
@@ -242,89 +883,83 @@ func (cfg *apiConfig) userCreateHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if reqValues.Email == "" || reqValues.Password == "" {
-		respondWithError(
-			w,
-			http.StatusUnprocessableEntity,
-			"'email' and 'password' are required",
-			errors.New("User did not provide emmail and password"))
+	errs := validationErrors{}
+	email, err := emailParam(reqValues.Email)
+	errs.add("email", err)
+	errs.add("password", cfg.passwordParam(reqValues.Password, reqValues.Email))
+	username, err := usernameParam(reqValues.Username)
+	errs.add("username", err)
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
 		return
 	}
 
-	passwordHashed, err := auth.HashPassword(reqValues.Password)
+	passwordHashed, err := cfg.passwords.Hash(reqValues.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error hashing password", err)
 		return
 	}
 
 	params := database.CreateUserParams{
-		Email:          reqValues.Email,
+		Email:          email,
 		HashedPassword: passwordHashed,
+		Username:       username,
 	}
 
 	user, err := cfg.dbQueries.CreateUser(context.Background(), params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating user", err)
+	if emailTaken(err) {
+		respondWithError(w, http.StatusConflict, "Email is already taken", err)
 		return
 	}
-
-	respondWithJSON(w, http.StatusCreated, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UdpatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
-	})
-}
-
-func (cfg *apiConfig) userUpdateHandler(w http.ResponseWriter, r *http.Request) {
-	tokenBearer, err := auth.BearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Authorization failed: %v", err), err)
+	if usernameTaken(err) {
+		respondWithError(w, http.StatusConflict, "Username is already taken", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(tokenBearer, cfg.tokenSecret)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		respondWithError(w, http.StatusInternalServerError, "Error creating user", err)
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	type UpdateRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-
-	updateRequest := UpdateRequest{}
-	err = decoder.Decode(&updateRequest)
+	err = cfg.emailVerificationSend(user, user.Email)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error decoding request", err)
+		respondWithError(w, http.StatusInternalServerError, "Error sending the verification email", err)
 		return
 	}
 
-	passwordHashed, err := auth.HashPassword(updateRequest.Password)
+	respondWithJSON(w, http.StatusCreated, userFromDB(user))
+}
+
+// userUpdateHandler replaces the email and password, and the username when
+// given. Like userPatchHandler, it takes the current password as well.
+func (cfg *apiConfig) userUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, sessionID, err := cfg.authenticateSession(r)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error hashing password", err)
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
 		return
 	}
 
-	userUpdateParams := database.UpdateUserParams{
-		Email:          updateRequest.Email,
-		HashedPassword: passwordHashed,
-		ID:             userID,
+	type parameters struct {
+		Email           string  `json:"email"`
+		Password        string  `json:"password"`
+		Username        *string `json:"username"`
+		CurrentPassword string  `json:"current_password"`
 	}
-	userDB, err := cfg.dbQueries.UpdateUser(context.Background(), userUpdateParams)
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error updating user", err)
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, User{
-		ID:          userDB.ID,
-		CreatedAt:   userDB.CreatedAt,
-		UdpatedAt:   userDB.UpdatedAt,
-		Email:       userDB.Email,
-		IsChirpyRed: userDB.IsChirpyRed,
+	// PUT replaces both, an empty email or password is never what was meant
+	// and fails validation
+	cfg.userAccountUpdate(w, r, userID, sessionID, userAccountChanges{
+		Email:           &params.Email,
+		Password:        &params.Password,
+		Username:        params.Username,
+		CurrentPassword: params.CurrentPassword,
 	})
 }
 
@@ -343,53 +978,172 @@ func (cfg *apiConfig) userLoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	wait, err := cfg.loginAttempt(r, reqValues.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+		return
+	}
+	if wait > 0 {
+		respondWithLoginThrottled(w, wait)
+		return
+	}
+
 	user, err := cfg.dbQueries.GetUserByEmail(context.Background(), reqValues.Email)
 	if err != nil {
+		cfg.loginFailed(r, reqValues.Email, nil)
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
 
-	err = auth.CheckPasswordHash(reqValues.Password, user.HashedPassword)
+	rehash, err := cfg.passwords.Check(reqValues.Password, user.HashedPassword)
 	if err != nil {
+		cfg.loginFailed(r, reqValues.Email, &user)
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
+	if rehash {
+		cfg.userPasswordRehash(user, reqValues.Password)
+	}
 
-	tokenJWT, err := auth.MakeJWT(user.ID, cfg.tokenSecret, time.Hour)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error making JWT token", err)
+	if user.TotpEnabledAt.Valid {
+		cfg.loginPasswordCorrect(r, user.Email)
+		cfg.mfaChallengeRespond(w, user)
 		return
 	}
 
-	tokenRefresh, err := auth.MakeRefreshToken()
+	cfg.userLoginRespond(w, r, user)
+}
+
+// userPasswordRehash upgrades the hash of the password the user just logged
+// in with to the current hasher and parameters. It's only an upgrade, so
+// errors are logged rather than failing the login.
+func (cfg *apiConfig) userPasswordRehash(user database.User, password string) {
+	hash, err := cfg.passwords.Hash(password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error making refresh token", err)
+		log.Printf("Error rehashing password of user %s: %s", user.ID, err)
 		return
 	}
 
-	tokenRefreshParams := database.CreateTokenParams{
-		Token:     tokenRefresh,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().AddDate(0, 0, 60),
+	// unless the password changed in the meantime
+	err = cfg.dbQueries.RehashUserPassword(context.Background(), database.RehashUserPasswordParams{
+		HashedPassword:    hash,
+		ID:                user.ID,
+		HashedPasswordOld: user.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("Error rehashing password of user %s: %s", user.ID, err)
+	}
+}
+
+// userLoginRespond logs in the user, starting a new session and answering
+// with its access and refresh tokens.
+func (cfg *apiConfig) userLoginRespond(w http.ResponseWriter, r *http.Request, user database.User) {
+	cfg.loginSucceeded(r, user.Email)
+
+	sessionID := uuid.New()
+	tokenJWT, err := cfg.keyRing.MakeJWT(user.ID, sessionID, accessTokenTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error making JWT token", err)
+		return
 	}
 
-	_, err = cfg.dbQueries.CreateToken(context.Background(), tokenRefreshParams)
+	tokenRefresh, err := cfg.refreshTokenCreate(cfg.dbQueries, r, user.ID, sessionID, cfg.now().UTC())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error creating refresh token", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, User{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UdpatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		IsChirpyRed:  user.IsChirpyRed,
-		Token:        tokenJWT,
-		TokenRefresh: tokenRefresh,
+	userResponse := userFromDB(user)
+	userResponse.Token = tokenJWT
+	userResponse.TokenRefresh = tokenRefresh
+	respondWithJSON(w, http.StatusOK, userResponse)
+}
+
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 60 * 24 * time.Hour
+)
+
+// refreshTokenCreate makes a refresh token in the session, its token family,
+// storing only its hash along with the device it was requested from.
+func (cfg *apiConfig) refreshTokenCreate(q *database.Queries, r *http.Request, userID, sessionID uuid.UUID, sessionCreatedAt time.Time) (string, error) {
+	return cfg.clientRefreshTokenCreate(q, r, userID, sessionID, sessionCreatedAt, uuid.NullUUID{}, nil)
+}
+
+// clientRefreshTokenCreate makes a refresh token like refreshTokenCreate in a
+// session of an OAuth client, limited to the scopes.
+func (cfg *apiConfig) clientRefreshTokenCreate(q *database.Queries, r *http.Request, userID, sessionID uuid.UUID, sessionCreatedAt time.Time, clientID uuid.NullUUID, scopes []string) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.CreateToken(context.Background(), database.CreateTokenParams{
+		TokenHash:       auth.HashToken(token),
+		FamilyID:        sessionID,
+		FamilyCreatedAt: sessionCreatedAt,
+		UserID:          userID,
+		ExpiresAt:       cfg.now().UTC().Add(refreshTokenTTL),
+		UserAgent:       userAgent(r),
+		Ip:              clientIP(r),
+		ClientID:        clientID,
+		Scopes:          scopes,
 	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+var (
+	errRefreshTokenInvalid = errors.New("refresh token doesn't exist or is expired")
+	errRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// refreshTokenRotate spends a refresh token of the client, or of a login
+// without one, for the caller to make the next one of its family. A refresh
+// token used twice means it leaked, so its whole family is revoked, logging
+// out both whoever stole it and the owner. The revocation is made with q
+// even though errRefreshTokenReused is returned, commit it.
+func (cfg *apiConfig) refreshTokenRotate(q *database.Queries, token string, clientID uuid.NullUUID) (database.RefreshToken, error) {
+	tokenOld, err := q.GetRefreshTokenForUpdate(context.Background(), auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.RefreshToken{}, errRefreshTokenInvalid
+	}
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	// tokens of OAuth clients never pass for a login's, nor the other way round
+	if tokenOld.ClientID != clientID {
+		return database.RefreshToken{}, errRefreshTokenInvalid
+	}
+
+	if tokenOld.RotatedAt.Valid {
+		err = q.RevokeRefreshTokenFamily(context.Background(), tokenOld.FamilyID)
+		if err != nil {
+			return database.RefreshToken{}, err
+		}
+		err = securityEventLog(q, tokenOld.UserID, securityEventRefreshTokenReuse,
+			fmt.Sprintf("refresh token rotated at %s was used again, revoked token family %s",
+				tokenOld.RotatedAt.Time.Format(time.RFC3339), tokenOld.FamilyID))
+		if err != nil {
+			return database.RefreshToken{}, err
+		}
+		return database.RefreshToken{}, errRefreshTokenReused
+	}
+	if tokenOld.RevokedAt.Valid || !tokenOld.ExpiresAt.After(cfg.now().UTC()) {
+		return database.RefreshToken{}, errRefreshTokenInvalid
+	}
+
+	err = q.RotateRefreshToken(context.Background(), tokenOld.TokenHash)
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	return tokenOld, nil
 }
 
+// tokenRefreshHandler trades a refresh token for an access token and a new
+// refresh token, so each refresh token works once.
 func (cfg *apiConfig) tokenRefreshHandler(w http.ResponseWriter, r *http.Request) {
 	tokenBearer, err := auth.BearerToken(r.Header)
 	if err != nil {
@@ -397,22 +1151,57 @@ func (cfg *apiConfig) tokenRefreshHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	userId, err := cfg.dbQueries.GetUserFromRefreshToken(context.Background(), tokenBearer)
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
 	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error refreshing token", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	tokenOld, err := cfg.refreshTokenRotate(qtx, tokenBearer, uuid.NullUUID{})
+	if errors.Is(err, errRefreshTokenInvalid) {
 		respondWithError(w, http.StatusUnauthorized, "Authorization failed, token doesn't exist or is expired", err)
 		return
 	}
+	if errors.Is(err, errRefreshTokenReused) {
+		err = tx.Commit()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error refreshing token", err)
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed, token was already used", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error refreshing token", err)
+		return
+	}
 
-	tokenJWT, err := auth.MakeJWT(userId, cfg.tokenSecret, time.Hour)
+	tokenRefresh, err := cfg.refreshTokenCreate(qtx, r, tokenOld.UserID, tokenOld.FamilyID, tokenOld.FamilyCreatedAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error refreshing token", err)
+		return
+	}
+
+	tokenJWT, err := cfg.keyRing.MakeJWT(tokenOld.UserID, tokenOld.FamilyID, accessTokenTTL)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
 		return
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error refreshing token", err)
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		TokenRefresh string `json:"refresh_token"`
 	}{
-		Token: tokenJWT,
+		Token:        tokenJWT,
+		TokenRefresh: tokenRefresh,
 	})
 }
 
@@ -423,7 +1212,7 @@ func (cfg *apiConfig) tokenRevokeHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = cfg.dbQueries.RevokeRefreshToken(context.Background(), tokenBearer)
+	err = cfg.dbQueries.RevokeRefreshToken(context.Background(), auth.HashToken(tokenBearer))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Token revokation failed", err)
 		return
@@ -432,6 +1221,30 @@ func (cfg *apiConfig) tokenRevokeHandler(w http.ResponseWriter, r *http.Request)
 	respondWithJSON(w, http.StatusNoContent, nil)
 }
 
+// authenticate returns the ID of the user owning the request's access token,
+// or API key on routes allowing them with withScope.
+func (cfg *apiConfig) authenticate(r *http.Request) (uuid.UUID, error) {
+	if p, ok := r.Context().Value(principalKey{}).(principal); ok {
+		return p.userID, nil
+	}
+	tokenBearer, err := auth.BearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	userID, _, err := cfg.keyRing.ValidateJWT(tokenBearer)
+	return userID, err
+}
+
+// viewer returns the ID of the logged in user making the request, if any.
+// Unlike authenticate, a missing or broken token is not an error here.
+func (cfg *apiConfig) viewer(r *http.Request) uuid.NullUUID {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: userID, Valid: true}
+}
+
 func (cfg *apiConfig) polkaHandler(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Event string `json:"event"`
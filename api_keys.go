@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// apiKeysMax is how many API keys a user can have at once.
+	apiKeysMax       = 20
+	apiKeyNameLenMax = 64
+)
+
+// APIKey is a long-lived key a user made for bots and integrations, doing
+// only what its scopes allow. Key is only ever returned when it's made.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func apiKeyFromDB(apiKey database.ApiKey) APIKey {
+	key := APIKey{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+	}
+	if apiKey.LastUsedAt.Valid {
+		key.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	return key
+}
+
+// apiKeyCreateHandler makes an API key. Only a login can, not another API
+// key, so a leaked key can't be used to make more.
+func (cfg *apiConfig) apiKeyCreateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	type parameters struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	errs := validationErrors{}
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		errs.add("name", errors.New("name is required"))
+	} else if utf8.RuneCountInString(name) > apiKeyNameLenMax {
+		errs.add("name", fmt.Errorf("name must be at most %d characters long", apiKeyNameLenMax))
+	}
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err == nil && len(scopes) == 0 {
+		err = errors.New("scopes are required, a key without any can't do anything")
+	}
+	errs.add("scopes", err)
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	count, err := cfg.dbQueries.CountUserAPIKeys(context.Background(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating API key", err)
+		return
+	}
+	if count >= apiKeysMax {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("You already have %d API keys, revoke one first", apiKeysMax), nil)
+		return
+	}
+
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating API key", err)
+		return
+	}
+
+	scopeNames := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scopeNames = append(scopeNames, string(scope))
+	}
+	apiKey, err := cfg.dbQueries.CreateAPIKey(context.Background(), database.CreateAPIKeyParams{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  prefix,
+		KeyHash: auth.HashToken(key),
+		Scopes:  scopeNames,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating API key", err)
+		return
+	}
+
+	response := apiKeyFromDB(apiKey)
+	response.Key = key
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetUserAPIKeys(context.Background(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving API keys", err)
+		return
+	}
+
+	apiKeys := make([]APIKey, 0, len(rows))
+	for _, row := range rows {
+		apiKeys = append(apiKeys, apiKeyFromDB(row))
+	}
+	respondWithJSON(w, http.StatusOK, apiKeys)
+}
+
+// apiKeyDeleteHandler revokes an API key, it stops working right away.
+func (cfg *apiConfig) apiKeyDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	apiKeyID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID", err)
+		return
+	}
+
+	revoked, err := cfg.dbQueries.RevokeAPIKey(context.Background(), database.RevokeAPIKeyParams{
+		ID:     apiKeyID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking API key", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "API key not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
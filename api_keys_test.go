@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+)
+
+// apiKeyCreate makes an API key of the logged in user with the scopes.
+func (api *testAPI) apiKeyCreate(t *testing.T, user User, scopes ...auth.Scope) APIKey {
+	t.Helper()
+	res := api.request(t, "POST", "/api/users/me/api-keys", bearer(user.Token), map[string]any{"name": "bot", "scopes": scopes})
+	if res.code != http.StatusCreated {
+		t.Fatalf("Error creating API key: %d %s", res.code, res.body)
+	}
+	apiKey := APIKey{}
+	res.decode(t, &apiKey)
+	return apiKey
+}
+
+func TestAPIKeyCreateHandler(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	user := api.login(t, api.userCreate(t), testPassword)
+	apiKey := api.apiKeyCreate(t, user, auth.ScopeChirpsRead, auth.ScopeChirpsWrite, auth.ScopeProfileWrite)
+
+	cases := map[string]struct {
+		authorization string
+		body          any
+		wantCode      int
+		wantFields    []string
+	}{
+		"key": {
+			authorization: bearer(user.Token),
+			body:          map[string]any{"name": "bot", "scopes": []string{"chirps:read"}},
+			wantCode:      http.StatusCreated,
+		},
+		"no name": {
+			authorization: bearer(user.Token),
+			body:          map[string]any{"scopes": []string{"chirps:read"}},
+			wantCode:      http.StatusUnprocessableEntity,
+			wantFields:    []string{"name"},
+		},
+		"unknown scope": {
+			authorization: bearer(user.Token),
+			body:          map[string]any{"name": "bot", "scopes": []string{"chirps:read", "chirps:delete"}},
+			wantCode:      http.StatusUnprocessableEntity,
+			wantFields:    []string{"scopes"},
+		},
+		"no scopes": {
+			authorization: bearer(user.Token),
+			body:          map[string]any{"name": " "},
+			wantCode:      http.StatusUnprocessableEntity,
+			wantFields:    []string{"name", "scopes"},
+		},
+		"made with an API key": {
+			authorization: "ApiKey " + apiKey.Key,
+			body:          map[string]any{"name": "bot", "scopes": []string{"chirps:read"}},
+			wantCode:      http.StatusUnauthorized,
+		},
+		"no token": {
+			body:     map[string]any{"name": "bot", "scopes": []string{"chirps:read"}},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			res := api.request(t, "POST", "/api/users/me/api-keys", c.authorization, c.body)
+			if res.code != c.wantCode {
+				t.Fatalf("POST /api/users/me/api-keys got %d %s, want %d", res.code, res.body, c.wantCode)
+			}
+			if c.wantFields != nil {
+				fields := slices.Sorted(maps.Keys(res.fields(t)))
+				if !reflect.DeepEqual(fields, c.wantFields) {
+					t.Errorf("POST /api/users/me/api-keys failed validation of %v, want %v", fields, c.wantFields)
+				}
+			}
+			if res.code != http.StatusCreated {
+				return
+			}
+
+			created := APIKey{}
+			res.decode(t, &created)
+			if !auth.IsUserAPIKey(created.Key) || !strings.HasPrefix(created.Key, created.Prefix) {
+				t.Errorf("POST /api/users/me/api-keys got key %q with prefix %q", created.Key, created.Prefix)
+			}
+		})
+	}
+
+	// the key itself is only shown once
+	res := api.request(t, "GET", "/api/users/me/api-keys", bearer(user.Token), nil)
+	if res.code != http.StatusOK {
+		t.Fatalf("GET /api/users/me/api-keys got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+	apiKeys := []APIKey{}
+	res.decode(t, &apiKeys)
+	if len(apiKeys) != 2 {
+		t.Errorf("GET /api/users/me/api-keys got %d keys, want 2", len(apiKeys))
+	}
+	for _, listed := range apiKeys {
+		if listed.Key != "" {
+			t.Errorf("GET /api/users/me/api-keys gave away key %s", listed.ID)
+		}
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	user := api.login(t, api.userCreate(t), testPassword)
+	keyRead := api.apiKeyCreate(t, user, auth.ScopeChirpsRead)
+	keyWrite := api.apiKeyCreate(t, user, auth.ScopeChirpsWrite)
+	keyProfile := api.apiKeyCreate(t, user, auth.ScopeProfileWrite)
+	keyRevoked := api.apiKeyCreate(t, user, auth.ScopeChirpsRead)
+
+	res := api.request(t, "DELETE", "/api/users/me/api-keys/"+keyRevoked.ID.String(), bearer(user.Token), nil)
+	if res.code != http.StatusNoContent {
+		t.Fatalf("DELETE /api/users/me/api-keys/%s got %d %s, want %d", keyRevoked.ID, res.code, res.body, http.StatusNoContent)
+	}
+
+	chirp := map[string]string{"body": "Posted by a bot"}
+	cases := map[string]struct {
+		method        string
+		path          string
+		authorization string
+		body          any
+		wantCode      int
+	}{
+		"read with chirps:read": {
+			method:        "GET",
+			path:          "/api/chirps",
+			authorization: "ApiKey " + keyRead.Key,
+			wantCode:      http.StatusOK,
+		},
+		"read with profile:write": {
+			method:        "GET",
+			path:          "/api/chirps",
+			authorization: "ApiKey " + keyProfile.Key,
+			wantCode:      http.StatusForbidden,
+		},
+		"post with chirps:read": {
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: "ApiKey " + keyRead.Key,
+			body:          chirp,
+			wantCode:      http.StatusForbidden,
+		},
+		"post with chirps:write": {
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: "ApiKey " + keyWrite.Key,
+			body:          chirp,
+			wantCode:      http.StatusCreated,
+		},
+		"post with a login": {
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(user.Token),
+			body:          chirp,
+			wantCode:      http.StatusCreated,
+		},
+		"read with a revoked key": {
+			method:        "GET",
+			path:          "/api/chirps",
+			authorization: "ApiKey " + keyRevoked.Key,
+			wantCode:      http.StatusUnauthorized,
+		},
+		"read with an unknown key": {
+			method:        "GET",
+			path:          "/api/chirps",
+			authorization: "ApiKey " + auth.APIKeyPrefix + "otter",
+			wantCode:      http.StatusUnauthorized,
+		},
+		"sessions with a key": {
+			method:        "GET",
+			path:          "/api/sessions",
+			authorization: "ApiKey " + keyProfile.Key,
+			wantCode:      http.StatusUnauthorized,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			res := api.request(t, c.method, c.path, c.authorization, c.body)
+			if res.code != c.wantCode {
+				t.Errorf("%s %s got %d %s, want %d", c.method, c.path, res.code, res.body, c.wantCode)
+			}
+		})
+	}
+
+	res = api.request(t, "GET", "/api/users/me/api-keys", bearer(user.Token), nil)
+	apiKeys := []APIKey{}
+	res.decode(t, &apiKeys)
+	for _, apiKey := range apiKeys {
+		if apiKey.ID == keyRead.ID && apiKey.LastUsedAt == nil {
+			t.Errorf("GET /api/users/me/api-keys got %s never used, want when it was last used", apiKey.ID)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestTokenRefreshHandler(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+
+	cases := map[string]struct {
+		// token returns the refresh token to send for a user who just
+		// logged in, "" to send none
+		token    func(t *testing.T, user User) string
+		wantCode int
+	}{
+		"refresh token": {
+			token:    func(t *testing.T, user User) string { return user.TokenRefresh },
+			wantCode: http.StatusOK,
+		},
+		"no token": {
+			token:    func(t *testing.T, user User) string { return "" },
+			wantCode: http.StatusUnauthorized,
+		},
+		"unknown token": {
+			token:    func(t *testing.T, user User) string { return "otter" },
+			wantCode: http.StatusUnauthorized,
+		},
+		"access token": {
+			token:    func(t *testing.T, user User) string { return user.Token },
+			wantCode: http.StatusUnauthorized,
+		},
+		"revoked": {
+			token: func(t *testing.T, user User) string {
+				res := api.request(t, "POST", "/api/revoke", bearer(user.TokenRefresh), nil)
+				if res.code != http.StatusNoContent {
+					t.Fatalf("POST /api/revoke got %d %s, want %d", res.code, res.body, http.StatusNoContent)
+				}
+				return user.TokenRefresh
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		"expired": {
+			token: func(t *testing.T, user User) string {
+				api.clock.Add(refreshTokenTTL)
+				return user.TokenRefresh
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		"already used": {
+			token: func(t *testing.T, user User) string {
+				res := api.request(t, "POST", "/api/refresh", bearer(user.TokenRefresh), nil)
+				if res.code != http.StatusOK {
+					t.Fatalf("first POST /api/refresh got %d %s, want %d", res.code, res.body, http.StatusOK)
+				}
+				return user.TokenRefresh
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			user := api.login(t, api.userCreate(t), testPassword)
+			authorization := ""
+			if token := c.token(t, user); token != "" {
+				authorization = bearer(token)
+			}
+
+			res := api.request(t, "POST", "/api/refresh", authorization, nil)
+			if res.code != c.wantCode {
+				t.Fatalf("POST /api/refresh got %d %s, want %d", res.code, res.body, c.wantCode)
+			}
+			if res.code != http.StatusOK {
+				return
+			}
+
+			tokens := User{}
+			res.decode(t, &tokens)
+			if tokens.TokenRefresh == "" || tokens.TokenRefresh == user.TokenRefresh {
+				t.Errorf("POST /api/refresh got refresh token %q, want a new one", tokens.TokenRefresh)
+			}
+			res = api.request(t, "GET", "/api/sessions", bearer(tokens.Token), nil)
+			if res.code != http.StatusOK {
+				t.Errorf("GET /api/sessions with the new access token got %d %s, want %d", res.code, res.body, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+
+	email := api.userCreate(t)
+	user := api.login(t, email, testPassword)
+	userElsewhere := api.login(t, email, testPassword)
+
+	res := api.request(t, "POST", "/api/refresh", bearer(user.TokenRefresh), nil)
+	if res.code != http.StatusOK {
+		t.Fatalf("POST /api/refresh got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+	rotated := User{}
+	res.decode(t, &rotated)
+
+	// whoever stole the first token uses it after the owner did
+	res = api.request(t, "POST", "/api/refresh", bearer(user.TokenRefresh), nil)
+	if res.code != http.StatusUnauthorized {
+		t.Fatalf("POST /api/refresh reusing a token got %d %s, want %d", res.code, res.body, http.StatusUnauthorized)
+	}
+
+	res = api.request(t, "POST", "/api/refresh", bearer(rotated.TokenRefresh), nil)
+	if res.code != http.StatusUnauthorized {
+		t.Errorf("POST /api/refresh with the rest of the family got %d, want %d", res.code, http.StatusUnauthorized)
+	}
+	res = api.request(t, "POST", "/api/refresh", bearer(userElsewhere.TokenRefresh), nil)
+	if res.code != http.StatusOK {
+		t.Errorf("POST /api/refresh of another session got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+	if got := api.securityEvents(t, user.ID, securityEventRefreshTokenReuse); got != 1 {
+		t.Errorf("got %d %s security events, want 1", got, securityEventRefreshTokenReuse)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+)
+
+// sha1Line is a line of the Have I Been Pwned password lists, a SHA-1 hash
+// optionally followed by how many breaches the password was seen in.
+var sha1Line = regexp.MustCompile(`^([0-9A-Fa-f]{40})(:\d+)?$`)
+
+// breachedFilterCommand builds the bloom filter of BREACHED_PASSWORDS_FILE
+// from password lists, one password per line, either in plain text or as
+// SHA-1 hashes like Have I Been Pwned publishes them.
+func breachedFilterCommand(args []string) error {
+	flags := flag.NewFlagSet("breached-filter", flag.ContinueOnError)
+	out := flags.String("out", "breached-passwords.bloom", "file to write the filter to")
+	fp := flags.Float64("fp", 0.001, "rate of passwords wrongly taken for breached")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("give the password lists to build the filter from")
+	}
+
+	// the filter is sized up front, so the lists are read twice
+	count := 0
+	err = eachListedPassword(flags.Args(), func(string) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	filter, err := auth.NewBloomFilter(count, *fp)
+	if err != nil {
+		return err
+	}
+	err = eachListedPassword(flags.Args(), func(line string) error {
+		match := sha1Line.FindStringSubmatch(line)
+		if match == nil {
+			filter.Add(line)
+			return nil
+		}
+		return filter.AddSHA1Hex(match[1])
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	_, err = filter.WriteTo(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d breached passwords to %s\n", count, *out)
+	return nil
+}
+
+func eachListedPassword(paths []string, fn func(line string) error) error {
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), "\r")
+			if line == "" {
+				continue
+			}
+			err = fn(line)
+			if err != nil {
+				file.Close()
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/el-damiano/bootdev-http-server/internal/moderation"
+	"github.com/google/uuid"
+)
+
+type FilterTerm struct {
+	Term   string            `json:"term"`
+	Action moderation.Action `json:"action"`
+}
+
+type ChirpFlag struct {
+	Chirp     Chirp     `json:"chirp"`
+	Terms     []string  `json:"terms"`
+	FlaggedAt time.Time `json:"flagged_at"`
+}
+
+type ChirpFlagsPage struct {
+	Flags      []ChirpFlag `json:"flags"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// loadContentFilter builds the word list from the file at path, when given,
+// and the terms stored in the database. Terms in the database win, including
+// the removed ones.
+func loadContentFilter(dbQueries *database.Queries, path string) (*moderation.WordList, error) {
+	wordList := moderation.NewWordList()
+
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		err = wordList.Load(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	terms, err := dbQueries.GetContentFilterTerms(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, term := range terms {
+		if term.RemovedAt.Valid {
+			wordList.Remove(term.Term)
+			continue
+		}
+		_, err = wordList.Set(term.Term, moderation.Action(term.Action))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return wordList, nil
+}
+
+// chirpSyncFlag marks a chirp for review when the content filter flagged any
+// of its words, or clears the mark when it no longer does.
+func chirpSyncFlag(qtx *database.Queries, chirp database.Chirp, flagged []string) error {
+	if len(flagged) == 0 {
+		return qtx.DeleteChirpFlag(context.Background(), chirp.ID)
+	}
+	return qtx.CreateChirpFlag(context.Background(), database.CreateChirpFlagParams{
+		ChirpID: chirp.ID,
+		Terms:   strings.Join(flagged, " "),
+	})
+}
+
+// authorizeAdmin checks the request carries the ADMIN_KEY. Without one
+// configured the admin API is off.
+func (cfg *apiConfig) authorizeAdmin(r *http.Request) error {
+	if cfg.adminKey == "" {
+		return errors.New("admin API is disabled")
+	}
+	apiKey, err := auth.APIKey(r.Header)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.adminKey)) != 1 {
+		return errors.New("invalid admin key")
+	}
+	return nil
+}
+
+func (cfg *apiConfig) filterTermsHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	terms := []FilterTerm{}
+	for _, term := range cfg.contentFilter.Terms() {
+		terms = append(terms, FilterTerm{Term: term.Term, Action: term.Action})
+	}
+
+	respondWithJSON(w, http.StatusOK, terms)
+}
+
+func (cfg *apiConfig) filterTermSetHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	params := FilterTerm{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	term, err := moderation.NormalizeTerm(params.Term)
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	}
+	if params.Action == "" {
+		params.Action = moderation.ActionMask
+	}
+	action, err := moderation.ParseAction(string(params.Action))
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
+		return
+	}
+
+	_, err = cfg.dbQueries.UpsertContentFilterTerm(context.Background(), database.UpsertContentFilterTermParams{
+		Term:   term,
+		Action: string(action),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving the term", err)
+		return
+	}
+
+	term, err = cfg.contentFilter.Set(term, action)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving the term", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, FilterTerm{Term: term, Action: action})
+}
+
+func (cfg *apiConfig) filterTermDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	term := moderation.Normalize(r.PathValue("term"))
+	action, ok := cfg.contentFilter.Lookup(term)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Term not found", nil)
+		return
+	}
+
+	// the removal is kept, or a term of CONTENT_FILTER_FILE would be back
+	// after a restart
+	err = cfg.dbQueries.RemoveContentFilterTerm(context.Background(), database.RemoveContentFilterTermParams{
+		Term:   term,
+		Action: string(action),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error removing the term", err)
+		return
+	}
+
+	cfg.contentFilter.Remove(term)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) chirpFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetChirpFlagsPage(context.Background(), database.GetChirpFlagsPageParams{
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving flagged chirps", err)
+		return
+	}
+
+	rows, nextCursor := pageTrim(rows, page, func(row database.GetChirpFlagsPageRow) pageCursor {
+		return pageCursor{CreatedAt: row.FlaggedAt, ID: row.Chirp.ID}
+	})
+
+	chirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, row.Chirp)
+	}
+	chirpsResponse, err := cfg.chirpsResponse(chirps, uuid.NullUUID{})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving flagged chirps", err)
+		return
+	}
+
+	flags := make([]ChirpFlag, 0, len(rows))
+	for i, row := range rows {
+		flags = append(flags, ChirpFlag{
+			Chirp:     chirpsResponse[i],
+			Terms:     strings.Fields(row.Terms),
+			FlaggedAt: row.FlaggedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpFlagsPage{
+		Flags:      flags,
+		NextCursor: nextCursor,
+	})
+}
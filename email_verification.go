@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/el-damiano/bootdev-http-server/internal/mail"
+)
+
+const emailVerificationTokenTTL = 24 * time.Hour
+
+// emailVerificationSend emails a token confirming the user owns email, which
+// is either their email or the pending one they are changing it to.
+func (cfg *apiConfig) emailVerificationSend(user database.User, email string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.dbQueries.CreateEmailVerificationToken(context.Background(), database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     email,
+		ExpiresAt: cfg.now().UTC().Add(emailVerificationTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg.mailSend(mail.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf("Confirm this is your email by sending this token to\n"+
+			"POST /api/users/verify within a day:\n\n%s\n\n"+
+			"If you don't have a Chirpy account, ignore this email.\n", token),
+	})
+	return nil
+}
+
+// userVerifyHandler confirms an email with a token from
+// emailVerificationSend. A confirmed pending email replaces the current one.
+func (cfg *apiConfig) userVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+	if params.Token == "" {
+		respondWithValidationErrors(w, validationErrors{"token": errors.New("token is required")})
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error verifying the email", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	verificationToken, err := qtx.GetEmailVerificationTokenForUpdate(context.Background(), database.GetEmailVerificationTokenForUpdateParams{
+		TokenHash: auth.HashToken(params.Token),
+		Now:       cfg.now().UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Verification token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error verifying the email", err)
+		return
+	}
+
+	user, err := qtx.VerifyUserEmail(context.Background(), database.VerifyUserEmailParams{
+		ID:    verificationToken.UserID,
+		Email: verificationToken.Email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = qtx.ConfirmUserPendingEmail(context.Background(), database.ConfirmUserPendingEmailParams{
+			ID:           verificationToken.UserID,
+			PendingEmail: verificationToken.Email,
+		})
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		// the email was changed again after the token was sent
+		respondWithError(w, http.StatusBadRequest, "Verification token is invalid or expired", err)
+		return
+	}
+	if emailTaken(err) {
+		respondWithError(w, http.StatusConflict, "Email is already taken", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error verifying the email", err)
+		return
+	}
+
+	err = qtx.UseEmailVerificationTokens(context.Background(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error verifying the email", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error verifying the email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userFromDB(user))
+}
+
+func (cfg *apiConfig) userVerifyResendHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(context.Background(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: user not found", err)
+		return
+	}
+
+	email := user.PendingEmail.String
+	if !user.PendingEmail.Valid {
+		if user.EmailVerifiedAt.Valid {
+			respondWithError(w, http.StatusConflict, "Email is already verified", nil)
+			return
+		}
+		email = user.Email
+	}
+
+	err = cfg.emailVerificationSend(user, email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error sending the verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// userEmailChanged sends a verification to the pending email, if the update
+// made one.
+func (cfg *apiConfig) userEmailChanged(user database.User, email sql.NullString) error {
+	if !email.Valid || !user.PendingEmail.Valid || user.PendingEmail.String != email.String {
+		return nil
+	}
+	return cfg.emailVerificationSend(user, user.PendingEmail.String)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type FollowsPage struct {
+	Users      []Follow `json:"users"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+func (cfg *apiConfig) followHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if followeeID == userID {
+		respondWithError(w, http.StatusUnprocessableEntity, "Users can't follow themselves", nil)
+		return
+	}
+
+	_, err = cfg.dbQueries.GetUserByID(context.Background(), followeeID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+
+	_, err = cfg.dbQueries.CreateFollow(context.Background(), database.CreateFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Following user failed", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unfollowHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+
+	_, err = cfg.dbQueries.DeleteFollow(context.Background(), database.DeleteFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unfollowing user failed", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) followersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, page, ok := cfg.followsRequest(w, r)
+	if !ok {
+		return
+	}
+
+	follows, err := cfg.dbQueries.GetFollowersPage(context.Background(), database.GetFollowersPageParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving followers", err)
+		return
+	}
+
+	follows, nextCursor := pageTrim(follows, page, func(follow database.Follow) pageCursor {
+		return pageCursor{CreatedAt: follow.CreatedAt, ID: follow.FollowerID}
+	})
+
+	users := make([]Follow, 0, len(follows))
+	for _, follow := range follows {
+		users = append(users, Follow{UserID: follow.FollowerID, FollowedAt: follow.CreatedAt})
+	}
+
+	respondWithJSON(w, http.StatusOK, FollowsPage{Users: users, NextCursor: nextCursor})
+}
+
+func (cfg *apiConfig) followingHandler(w http.ResponseWriter, r *http.Request) {
+	userID, page, ok := cfg.followsRequest(w, r)
+	if !ok {
+		return
+	}
+
+	follows, err := cfg.dbQueries.GetFollowingPage(context.Background(), database.GetFollowingPageParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving followed users", err)
+		return
+	}
+
+	follows, nextCursor := pageTrim(follows, page, func(follow database.Follow) pageCursor {
+		return pageCursor{CreatedAt: follow.CreatedAt, ID: follow.FolloweeID}
+	})
+
+	users := make([]Follow, 0, len(follows))
+	for _, follow := range follows {
+		users = append(users, Follow{UserID: follow.FolloweeID, FollowedAt: follow.CreatedAt})
+	}
+
+	respondWithJSON(w, http.StatusOK, FollowsPage{Users: users, NextCursor: nextCursor})
+}
+
+// followsRequest parses what the follower and following listings have in
+// common, responding with an error and returning false if anything is off.
+func (cfg *apiConfig) followsRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, pageRequest, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return uuid.Nil, pageRequest{}, false
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return uuid.Nil, pageRequest{}, false
+	}
+
+	_, err = cfg.dbQueries.GetUserByID(context.Background(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return uuid.Nil, pageRequest{}, false
+	}
+
+	return userID, page, true
+}
+
+func (cfg *apiConfig) timelineHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	chirps, err := cfg.dbQueries.GetTimelinePage(context.Background(), database.GetTimelinePageParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the timeline", err)
+		return
+	}
+
+	chirps, nextCursor := pageTrim(chirps, page, chirpCursor)
+
+	chirpsResponse, err := cfg.chirpsResponse(chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the timeline", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpsPage{
+		Chirps:     chirpsResponse,
+		NextCursor: nextCursor,
+	})
+}
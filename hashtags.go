@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/chirptext"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+)
+
+const (
+	trendingWindowDefault = 24 * time.Hour
+	trendingWindowMax     = 7 * 24 * time.Hour
+	trendingLimitDefault  = 10
+	trendingLimitMax      = 50
+)
+
+type Hashtag struct {
+	Tag        string `json:"tag"`
+	ChirpCount int64  `json:"chirp_count"`
+}
+
+// chirpSyncHashtags replaces the hashtags stored for a chirp with the ones in
+// its current body.
+func chirpSyncHashtags(qtx *database.Queries, chirp database.Chirp) error {
+	err := qtx.DeleteChirpHashtags(context.Background(), chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range chirptext.Hashtags(chirp.Body) {
+		err = qtx.CreateChirpHashtag(context.Background(), database.CreateChirpHashtagParams{
+			ChirpID:   chirp.ID,
+			Tag:       tag,
+			CreatedAt: chirp.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) hashtagChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := chirptext.NormalizeHashtag(r.PathValue("tag"))
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Invalid hashtag", nil)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	chirps, err := cfg.dbQueries.GetHashtagChirpsPage(context.Background(), database.GetHashtagChirpsPageParams{
+		Tag:             tag,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the chirps", err)
+		return
+	}
+
+	chirps, nextCursor := pageTrim(chirps, page, chirpCursor)
+
+	chirpsResponse, err := cfg.chirpsResponse(chirps, cfg.viewer(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the chirps", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpsPage{
+		Chirps:     chirpsResponse,
+		NextCursor: nextCursor,
+	})
+}
+
+func (cfg *apiConfig) hashtagsTrendingHandler(w http.ResponseWriter, r *http.Request) {
+	window := trendingWindowDefault
+	windowString := r.URL.Query().Get("window")
+	if windowString != "" {
+		var err error
+		window, err = time.ParseDuration(windowString)
+		if err != nil || window <= 0 || window > trendingWindowMax {
+			respondWithError(w, http.StatusBadRequest, "window must be a duration between 0 and 168h, like 24h", err)
+			return
+		}
+	}
+
+	limit := trendingLimitDefault
+	limitString := r.URL.Query().Get("limit")
+	if limitString != "" {
+		var err error
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 {
+			respondWithError(w, http.StatusBadRequest, "limit must be a positive integer", err)
+			return
+		}
+		limit = min(limit, trendingLimitMax)
+	}
+
+	trending, err := cfg.dbQueries.GetTrendingHashtags(context.Background(), database.GetTrendingHashtagsParams{
+		Since:    cfg.now().UTC().Add(-window),
+		TagLimit: int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving trending hashtags", err)
+		return
+	}
+
+	hashtags := make([]Hashtag, 0, len(trending))
+	for _, hashtag := range trending {
+		hashtags = append(hashtags, Hashtag{Tag: hashtag.Tag, ChirpCount: hashtag.ChirpCount})
+	}
+
+	respondWithJSON(w, http.StatusOK, hashtags)
+}
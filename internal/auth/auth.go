@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -11,37 +12,37 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// HashPassword hashes the password with the default argon2id parameters.
 func HashPassword(password string) (string, error) {
-	pass, err := bcrypt.GenerateFromPassword([]byte(password), 8)
-	if err != nil {
-		return "", err
-	}
-	return string(pass), nil
+	return NewPasswords(DefaultArgon2idParams).Hash(password)
 }
 
+// CheckPasswordHash checks the password against an argon2id or bcrypt hash.
 func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := NewPasswords(DefaultArgon2idParams).Check(password, hash)
+	return err
+}
+
+// claims are the claims of an access token. SessionID is the login the token
+// was issued for, if any. Tokens of OAuth clients name the client and the
+// space separated scopes they are limited to.
+type claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
 }
 
 func MakeJWT(userId uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	expirationDate := &jwt.NumericDate{
-		Time: time.Now().Add(expiresIn * time.Second),
-	}
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.RegisteredClaims{
-			Issuer:    "chirpy",
-			Subject:   userId.String(),
-			ExpiresAt: expirationDate,
-			IssuedAt:  &jwt.NumericDate{Time: time.Now().UTC()},
-		})
+	return MakeSessionJWT(userId, uuid.Nil, tokenSecret, expiresIn)
+}
+
+// MakeSessionJWT makes an access token like MakeJWT, naming the session it
+// belongs to in the sid claim.
+func MakeSessionJWT(userId, sessionID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(userId, sessionID, time.Now(), expiresIn))
 
 	tokenSigned, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
@@ -50,27 +51,58 @@ func MakeJWT(userId uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return tokenSigned, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	type MyCustomClaims struct {
-		jwt.RegisteredClaims
+func newClaims(userID, sessionID uuid.UUID, now time.Time, expiresIn time.Duration) claims {
+	now = now.UTC()
+	tokenClaims := claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Subject:   userID.String(),
+			ExpiresAt: &jwt.NumericDate{Time: now.Add(expiresIn)},
+			IssuedAt:  &jwt.NumericDate{Time: now},
+		},
 	}
+	if sessionID != uuid.Nil {
+		tokenClaims.SessionID = sessionID.String()
+	}
+	return tokenClaims
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, &MyCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
-
+// ids returns the user and the session of the token.
+func (c *claims) ids() (uuid.UUID, uuid.UUID, error) {
+	userID, err := uuid.Parse(c.Subject)
 	if err != nil {
-		return uuid.UUID{}, err
-	} else if claims, ok := token.Claims.(*MyCustomClaims); ok {
-		userID, err := uuid.Parse(claims.Subject)
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	sessionID := uuid.Nil
+	if c.SessionID != "" {
+		sessionID, err = uuid.Parse(c.SessionID)
 		if err != nil {
-			fmt.Printf("err %v\n", err)
-			return uuid.UUID{}, err
+			return uuid.Nil, uuid.Nil, err
 		}
+	}
+	return userID, sessionID, nil
+}
+
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	userID, _, err := ValidateSessionJWT(tokenString, tokenSecret)
+	return userID, err
+}
+
+// ValidateSessionJWT validates an access token like ValidateJWT, returning
+// the session it belongs to as well. Tokens without one return uuid.Nil.
+// Only HS256 is accepted, whatever the token claims to be signed with.
+func ValidateSessionJWT(tokenString, tokenSecret string) (uuid.UUID, uuid.UUID, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &claims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(tokenSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
-		return userID, nil
+	if err != nil {
+		return uuid.UUID{}, uuid.UUID{}, err
+	} else if tokenClaims, ok := token.Claims.(*claims); ok {
+		return tokenClaims.ids()
 	} else {
-		return uuid.UUID{}, errors.New("unknown claim type, cannot proceed")
+		return uuid.UUID{}, uuid.UUID{}, errors.New("unknown claim type, cannot proceed")
 	}
 }
 
@@ -116,3 +148,11 @@ func MakeRefreshToken() (string, error) {
 	}
 	return hex.EncodeToString(tokenRaw), nil
 }
+
+// HashToken hashes a random token for storage, so a leaked database doesn't
+// leak working tokens. Tokens are random enough that no salt or slow hash is
+// needed, unlike passwords.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -133,6 +134,50 @@ func TestJWT(t *testing.T) {
 	}
 }
 
+func TestSessionJWT(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+	tokenSecret := "totes secret"
+
+	tokenSession, err := MakeSessionJWT(userID, sessionID, tokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("Error during JWT creation: %v", err)
+	}
+	tokenNoSession, err := MakeJWT(userID, tokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("Error during JWT creation: %v", err)
+	}
+
+	cases := map[string]struct {
+		tokenString       string
+		expectedSessionID uuid.UUID
+	}{
+		"token with session": {
+			tokenString:       tokenSession,
+			expectedSessionID: sessionID,
+		},
+		"token without session": {
+			tokenString:       tokenNoSession,
+			expectedSessionID: uuid.Nil,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			gotUserID, gotSessionID, err := ValidateSessionJWT(c.tokenString, tokenSecret)
+			if err != nil {
+				t.Fatalf("ValidateSessionJWT() error = %v", err)
+			}
+			if gotUserID != userID {
+				t.Errorf("ValidateSessionJWT() gotUserID = %v, want %v", gotUserID, userID)
+			}
+			if gotSessionID != c.expectedSessionID {
+				t.Errorf("ValidateSessionJWT() gotSessionID = %v, want %v", gotSessionID, c.expectedSessionID)
+			}
+		})
+	}
+}
+
 func TestBearerToken(t *testing.T) {
 	cases := map[string]struct {
 		header       http.Header
@@ -189,3 +234,170 @@ func TestBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	cases := map[string]struct {
+		token string
+		want  string
+	}{
+		"empty": {
+			token: "",
+			want:  "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		"token": {
+			token: "abc",
+			want:  "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got := HashToken(c.token)
+			if got != c.want {
+				t.Errorf("HashToken() got = %v, want %v", got, c.want)
+			}
+			if got == c.token {
+				t.Errorf("HashToken() returned the token itself")
+			}
+		})
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 vectors truncated to 6 digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	cases := map[string]struct {
+		time time.Time
+		want string
+	}{
+		"59": {
+			time: time.Unix(59, 0),
+			want: "287082",
+		},
+		"1111111109": {
+			time: time.Unix(1111111109, 0),
+			want: "081804",
+		},
+		"1111111111": {
+			time: time.Unix(1111111111, 0),
+			want: "050471",
+		},
+		"1234567890": {
+			time: time.Unix(1234567890, 0),
+			want: "005924",
+		},
+		"2000000000": {
+			time: time.Unix(2000000000, 0),
+			want: "279037",
+		},
+		"20000000000": {
+			time: time.Unix(20000000000, 0),
+			want: "353130",
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got, err := TOTPCode(secret, c.time)
+			if err != nil {
+				t.Fatalf("TOTPCode() error = %v", err)
+			}
+			if got != c.want {
+				t.Errorf("TOTPCode() got = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := MakeTOTPSecret()
+	if err != nil {
+		t.Fatalf("MakeTOTPSecret() error = %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode() error = %v", err)
+	}
+	step := TOTPStep(now)
+
+	cases := map[string]struct {
+		code     string
+		time     time.Time
+		lastStep int64
+		wantErr  bool
+	}{
+		"current code": {
+			code: code,
+			time: now,
+		},
+		"code with spaces": {
+			code: code[:3] + " " + code[3:],
+			time: now,
+		},
+		"clock one period ahead": {
+			code: code,
+			time: now.Add(TOTPPeriod),
+		},
+		"clock one period behind": {
+			code: code,
+			time: now.Add(-TOTPPeriod),
+		},
+		"clock two periods ahead": {
+			code:    code,
+			time:    now.Add(2 * TOTPPeriod),
+			wantErr: true,
+		},
+		"code already used": {
+			code:     code,
+			time:     now,
+			lastStep: step,
+			wantErr:  true,
+		},
+		"wrong code": {
+			code:    "000000",
+			time:    now,
+			wantErr: code != "000000",
+		},
+		"too short": {
+			code:    code[:5],
+			time:    now,
+			wantErr: true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got, err := ValidateTOTP(secret, c.code, c.time, c.lastStep)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("ValidateTOTP() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if err == nil && got != step {
+				t.Errorf("ValidateTOTP() got step = %v, want %v", got, step)
+			}
+		})
+	}
+}
+
+func TestMakeRecoveryCodes(t *testing.T) {
+	codes, err := MakeRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("MakeRecoveryCodes() error = %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 9 || code[4] != '-' {
+			t.Errorf("MakeRecoveryCodes() got malformed code %q", code)
+		}
+		if NormalizeRecoveryCode(strings.ToUpper(code)) != strings.ReplaceAll(code, "-", "") {
+			t.Errorf("NormalizeRecoveryCode() didn't normalize %q", code)
+		}
+		if seen[code] {
+			t.Errorf("MakeRecoveryCodes() got duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
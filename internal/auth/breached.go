@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// bloomMagic starts every bloom filter file, followed by the number of bits
+// and of hash functions, then the bits.
+const bloomMagic = "CHIRPYBF"
+
+// bloomBitsMax keeps a corrupt file from allocating all the memory there is,
+// 2^35 bits is 4 GiB, enough for a billion passwords at 1 in 10^6 false
+// positives.
+const bloomBitsMax = 1 << 35
+
+// BloomFilter is a set of breached passwords, looked up locally so no
+// password or prefix of its hash leaves the server. Passwords are kept by
+// their SHA-1 hash, the form Have I Been Pwned publishes them in. It may
+// take a password for breached at the false positive rate it was made for,
+// but never misses one that was added.
+type BloomFilter struct {
+	bits   []uint64
+	m      uint64
+	hashes uint32
+}
+
+// NewBloomFilter returns an empty filter sized for n passwords at the false
+// positive rate fp, like 0.001.
+func NewBloomFilter(n int, fp float64) (*BloomFilter, error) {
+	if n < 1 {
+		n = 1
+	}
+	if fp <= 0 || fp >= 1 {
+		return nil, fmt.Errorf("false positive rate must be between 0 and 1, got %v", fp)
+	}
+	m := math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2))
+	if m > bloomBitsMax {
+		return nil, fmt.Errorf("a filter for %d passwords at %v false positives is too large", n, fp)
+	}
+	hashes := max(1, math.Round(m/float64(n)*math.Ln2))
+	return newBloomFilter(uint64(m), uint32(hashes)), nil
+}
+
+func newBloomFilter(m uint64, hashes uint32) *BloomFilter {
+	m = (m + 63) / 64 * 64
+	return &BloomFilter{bits: make([]uint64, m/64), m: m, hashes: hashes}
+}
+
+// Add adds a plain text password.
+func (f *BloomFilter) Add(password string) {
+	f.AddSHA1(sha1.Sum([]byte(password)))
+}
+
+// AddSHA1 adds a password by its SHA-1 hash.
+func (f *BloomFilter) AddSHA1(sum [sha1.Size]byte) {
+	h1, h2 := bloomHashes(sum)
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// AddSHA1Hex adds a password by its hex encoded SHA-1 hash.
+func (f *BloomFilter) AddSHA1Hex(hash string) error {
+	sum := [sha1.Size]byte{}
+	if hex.DecodedLen(len(hash)) != sha1.Size {
+		return fmt.Errorf("%q is not a SHA-1 hash", hash)
+	}
+	_, err := hex.Decode(sum[:], []byte(hash))
+	if err != nil {
+		return fmt.Errorf("%q is not a SHA-1 hash: %w", hash, err)
+	}
+	f.AddSHA1(sum)
+	return nil
+}
+
+func (f *BloomFilter) Contains(password string) bool {
+	h1, h2 := bloomHashes(sha1.Sum([]byte(password)))
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes derives the hash functions from two halves of the SHA-1 hash,
+// which is random enough on its own to not need hashing again.
+func bloomHashes(sum [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(sum[0:8]), binary.BigEndian.Uint64(sum[8:16]) | 1
+}
+
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	buf := bufio.NewWriter(w)
+	written := int64(0)
+
+	header := make([]byte, 0, len(bloomMagic)+12)
+	header = append(header, bloomMagic...)
+	header = binary.BigEndian.AppendUint64(header, f.m)
+	header = binary.BigEndian.AppendUint32(header, f.hashes)
+	n, err := buf.Write(header)
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	word := make([]byte, 8)
+	for _, bits := range f.bits {
+		binary.BigEndian.PutUint64(word, bits)
+		n, err := buf.Write(word)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, buf.Flush()
+}
+
+// ReadBloomFilter reads a filter written by WriteTo.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	buf := bufio.NewReader(r)
+
+	header := make([]byte, len(bloomMagic)+12)
+	_, err := io.ReadFull(buf, header)
+	if err != nil {
+		return nil, fmt.Errorf("reading the bloom filter header: %w", err)
+	}
+	if string(header[:len(bloomMagic)]) != bloomMagic {
+		return nil, errors.New("not a bloom filter file")
+	}
+	m := binary.BigEndian.Uint64(header[len(bloomMagic):])
+	hashes := binary.BigEndian.Uint32(header[len(bloomMagic)+8:])
+	if m == 0 || m%64 != 0 || m > bloomBitsMax || hashes == 0 || hashes > 64 {
+		return nil, fmt.Errorf("bloom filter of %d bits and %d hashes is corrupt", m, hashes)
+	}
+
+	f := newBloomFilter(m, hashes)
+	word := make([]byte, 8)
+	for i := range f.bits {
+		_, err := io.ReadFull(buf, word)
+		if err != nil {
+			return nil, fmt.Errorf("reading the bloom filter: %w", err)
+		}
+		f.bits[i] = binary.BigEndian.Uint64(word)
+	}
+	return f, nil
+}
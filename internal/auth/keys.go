@@ -0,0 +1,434 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Algorithms access tokens can be signed with.
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+)
+
+var (
+	ErrUnknownKey        = errors.New("token signed with an unknown key")
+	ErrAlgorithmMismatch = errors.New("token algorithm doesn't match its key")
+	ErrTokenScoped       = errors.New("access token of an OAuth client, limited to its scopes")
+)
+
+// SigningKey is a private key for signing access tokens. Its ID is the
+// RFC 7638 thumbprint of its public key, sent as the kid of tokens.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	// SignsAt is when the key starts signing. Until then it only verifies,
+	// so whoever verifies tokens has it before the first one it signs.
+	SignsAt time.Time
+	private crypto.Signer
+}
+
+// GenerateSigningKey makes a new key for the algorithm.
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(algorithm, private)
+}
+
+// ParseSigningKey reads a key written by MarshalPEM.
+func ParseSigningKey(algorithm, pemData string) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PKCS #8 private key found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return newSigningKey(algorithm, private)
+}
+
+func newSigningKey(algorithm string, private crypto.Signer) (*SigningKey, error) {
+	switch private.(type) {
+	case ed25519.PrivateKey:
+		if algorithm != AlgorithmEdDSA {
+			return nil, fmt.Errorf("can't sign %s with an Ed25519 key", algorithm)
+		}
+	case *rsa.PrivateKey:
+		if algorithm != AlgorithmRS256 {
+			return nil, fmt.Errorf("can't sign %s with an RSA key", algorithm)
+		}
+	case *ecdsa.PrivateKey:
+		if algorithm != AlgorithmES256 || private.Public().(*ecdsa.PublicKey).Curve != elliptic.P256() {
+			return nil, fmt.Errorf("can't sign %s with this ECDSA key", algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+
+	key := &SigningKey{Algorithm: algorithm, private: private}
+	thumbprint, err := key.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	key.ID = thumbprint
+	return key, nil
+}
+
+// MarshalPEM writes the private key as PKCS #8 PEM, for storage.
+func (k *SigningKey) MarshalPEM() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// JWK is a public key as RFC 7517 JSON.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKSet is what /.well-known/jwks.json serves.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public key for others to verify tokens with.
+func (k *SigningKey) JWK() JWK {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{ID: k.ID, Algorithm: k.Algorithm, Use: "sig"}
+
+	switch public := k.private.Public().(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = b64(public)
+	case *rsa.PublicKey:
+		exponent := make([]byte, 8)
+		binary.BigEndian.PutUint64(exponent, uint64(public.E))
+		for len(exponent) > 1 && exponent[0] == 0 {
+			exponent = exponent[1:]
+		}
+		jwk.KeyType = "RSA"
+		jwk.N = b64(public.N.Bytes())
+		jwk.E = b64(exponent)
+	case *ecdsa.PublicKey:
+		// uncompressed point, 0x04 then X and Y
+		ecdhPublic, err := public.ECDH()
+		if err != nil {
+			break
+		}
+		point := ecdhPublic.Bytes()
+		size := (len(point) - 1) / 2
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = b64(point[1 : 1+size])
+		jwk.Y = b64(point[1+size:])
+	}
+	return jwk
+}
+
+// thumbprint is the RFC 7638 thumbprint, the hash of the required members of
+// the JWK in lexicographic order.
+func (k *SigningKey) thumbprint() (string, error) {
+	jwk := k.JWK()
+
+	var members any
+	switch jwk.KeyType {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y}
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// KeyRing signs access tokens with its newest key due to sign and verifies
+// them with any of its keys, so keys can be rotated without invalidating
+// tokens already handed out. Each key only verifies tokens of its own
+// algorithm.
+type KeyRing struct {
+	mu        sync.RWMutex
+	keys      []*SigningKey
+	verifying map[string]*SigningKey
+
+	// legacySecret verifies HS256 tokens from before the key ring, which
+	// have no kid, until legacyUntil. Whoever knows it could make tokens
+	// forever otherwise.
+	legacySecret []byte
+	legacyUntil  time.Time
+
+	// Now is the clock tokens are issued and expire by, time.Now if nil.
+	Now func() time.Time
+}
+
+func (k *KeyRing) now() time.Time {
+	if k.Now != nil {
+		return k.Now()
+	}
+	return time.Now()
+}
+
+// NewKeyRing returns an empty key ring, Load keys before use. A non-empty
+// legacySecret keeps accepting HS256 tokens signed with it for as long as
+// AcceptLegacyUntil allows, not at all by default.
+func NewKeyRing(legacySecret string) *KeyRing {
+	ring := &KeyRing{verifying: map[string]*SigningKey{}}
+	if legacySecret != "" {
+		ring.legacySecret = []byte(legacySecret)
+	}
+	return ring
+}
+
+// AcceptLegacyUntil accepts tokens signed with the legacy secret until the
+// time, when the last of them has expired.
+func (k *KeyRing) AcceptLegacyUntil(until time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.legacyUntil = until
+}
+
+// LegacyUntil returns until when tokens signed with the legacy secret are
+// accepted.
+func (k *KeyRing) LegacyUntil() time.Time {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.legacyUntil
+}
+
+// Load replaces the keys of the ring, newest first.
+func (k *KeyRing) Load(keys []*SigningKey) error {
+	if len(keys) == 0 {
+		return errors.New("no signing keys")
+	}
+
+	verifying := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		verifying[key.ID] = key
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.verifying = verifying
+	return nil
+}
+
+// signing returns the newest key due to sign, or the oldest if none is yet.
+func (k *KeyRing) signing() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.keys) == 0 {
+		return nil
+	}
+	now := k.now()
+	for _, key := range k.keys {
+		if !key.SignsAt.After(now) {
+			return key
+		}
+	}
+	return k.keys[len(k.keys)-1]
+}
+
+// JWKS returns the public keys tokens may be signed with, the one signing
+// now first. Keys yet to sign are in it too, so caches have them in time.
+func (k *KeyRing) JWKS() JWKSet {
+	signing := k.signing()
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(k.keys))}
+	if signing != nil {
+		set.Keys = append(set.Keys, signing.JWK())
+	}
+	for _, key := range k.keys {
+		if key != signing {
+			set.Keys = append(set.Keys, key.JWK())
+		}
+	}
+	return set
+}
+
+// MakeJWT makes an access token like MakeSessionJWT, signed with the newest
+// key of the ring.
+func (k *KeyRing) MakeJWT(userID, sessionID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return k.MakeClientJWT(userID, sessionID, "", nil, expiresIn)
+}
+
+// MakeClientJWT makes an access token like MakeJWT for an OAuth client,
+// limited to the scopes.
+func (k *KeyRing) MakeClientJWT(userID, sessionID uuid.UUID, clientID string, scopes []Scope, expiresIn time.Duration) (string, error) {
+	signing := k.signing()
+	if signing == nil {
+		return "", errors.New("no signing keys")
+	}
+
+	tokenClaims := newClaims(userID, sessionID, k.now(), expiresIn)
+	tokenClaims.ClientID = clientID
+	tokenClaims.Scope = ScopeString(scopes)
+	token := jwt.NewWithClaims(signing.method(), tokenClaims)
+	token.Header["kid"] = signing.ID
+	return token.SignedString(signing.private)
+}
+
+// AccessToken is what a valid access token says.
+type AccessToken struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	// ClientID is the OAuth client the token was made for, limited to
+	// Scopes. Tokens of the user's own logins have none and may do anything.
+	ClientID  string
+	Scopes    []Scope
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// ParseJWT validates an access token, checking it against the key its kid
+// names, and returns what it says.
+func (k *KeyRing) ParseJWT(tokenString string) (AccessToken, error) {
+	methods := []string{AlgorithmEdDSA, AlgorithmRS256, AlgorithmES256}
+	if k.legacySecret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims{}, k.keyFunc, jwt.WithValidMethods(methods), jwt.WithTimeFunc(k.now))
+	if err != nil {
+		return AccessToken{}, err
+	}
+	tokenClaims, ok := token.Claims.(*claims)
+	if !ok {
+		return AccessToken{}, errors.New("unknown claim type, cannot proceed")
+	}
+
+	userID, sessionID, err := tokenClaims.ids()
+	if err != nil {
+		return AccessToken{}, err
+	}
+	accessToken := AccessToken{
+		UserID:    userID,
+		SessionID: sessionID,
+		ClientID:  tokenClaims.ClientID,
+	}
+	if tokenClaims.IssuedAt != nil {
+		accessToken.IssuedAt = tokenClaims.IssuedAt.Time
+	}
+	if tokenClaims.ExpiresAt != nil {
+		accessToken.ExpiresAt = tokenClaims.ExpiresAt.Time
+	}
+	if accessToken.ClientID != "" {
+		accessToken.Scopes, err = ParseScopes(strings.Fields(tokenClaims.Scope))
+		if err != nil {
+			return AccessToken{}, err
+		}
+	}
+	return accessToken, nil
+}
+
+// ValidateJWT validates an access token of the user's own login like
+// ValidateSessionJWT, checking it against the key its kid names. Tokens of
+// OAuth clients fail with ErrTokenScoped, they may only do what their
+// scopes allow, use ParseJWT for them.
+func (k *KeyRing) ValidateJWT(tokenString string) (uuid.UUID, uuid.UUID, error) {
+	token, err := k.ParseJWT(tokenString)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	if token.ClientID != "" {
+		return uuid.Nil, uuid.Nil, ErrTokenScoped
+	}
+	return token.UserID, token.SessionID, nil
+}
+
+func (k *KeyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if k.legacySecret != nil && token.Method == jwt.SigningMethodHS256 && k.now().Before(k.LegacyUntil()) {
+			return k.legacySecret, nil
+		}
+		return nil, ErrUnknownKey
+	}
+
+	k.mu.RLock()
+	key, ok := k.verifying[kid]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.private.Public(), nil
+}
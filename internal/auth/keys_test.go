@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestSigningKeyThumbprint(t *testing.T) {
+	// RFC 8037 appendix A
+	seed, err := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := newSigningKey(AlgorithmEdDSA, ed25519.NewKeyFromSeed(seed))
+	if err != nil {
+		t.Fatalf("newSigningKey() error = %v", err)
+	}
+	if want := "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"; key.ID != want {
+		t.Errorf("newSigningKey() ID = %v, want %v", key.ID, want)
+	}
+	if want := "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"; key.JWK().X != want {
+		t.Errorf("JWK() x = %v, want %v", key.JWK().X, want)
+	}
+}
+
+func TestSigningKeyPEM(t *testing.T) {
+	cases := map[string]struct {
+		algorithm string
+	}{
+		"EdDSA": {algorithm: AlgorithmEdDSA},
+		"RS256": {algorithm: AlgorithmRS256},
+		"ES256": {algorithm: AlgorithmES256},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			key, err := GenerateSigningKey(c.algorithm)
+			if err != nil {
+				t.Fatalf("GenerateSigningKey() error = %v", err)
+			}
+
+			data, err := key.MarshalPEM()
+			if err != nil {
+				t.Fatalf("MarshalPEM() error = %v", err)
+			}
+			parsed, err := ParseSigningKey(c.algorithm, data)
+			if err != nil {
+				t.Fatalf("ParseSigningKey() error = %v", err)
+			}
+			if parsed.ID != key.ID {
+				t.Errorf("ParseSigningKey() ID = %v, want %v", parsed.ID, key.ID)
+			}
+
+			wrongAlgorithm := AlgorithmEdDSA
+			if c.algorithm == AlgorithmEdDSA {
+				wrongAlgorithm = AlgorithmRS256
+			}
+			_, err = ParseSigningKey(wrongAlgorithm, data)
+			if err == nil {
+				t.Errorf("ParseSigningKey() accepted a %s key as %s", c.algorithm, wrongAlgorithm)
+			}
+		})
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+	const legacySecret = "totes secret"
+
+	keyOld, err := GenerateSigningKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyNew, err := GenerateSigningKey(AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyRemoved, err := GenerateSigningKey(AlgorithmRS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ringOld := NewKeyRing("")
+	ringOld.Load([]*SigningKey{keyOld})
+	ringRemoved := NewKeyRing("")
+	ringRemoved.Load([]*SigningKey{keyRemoved})
+	ring := NewKeyRing(legacySecret)
+	ring.Load([]*SigningKey{keyNew, keyOld})
+	ring.AcceptLegacyUntil(time.Now().Add(time.Hour))
+
+	tokenNew, err := ring.MakeJWT(userID, sessionID, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	tokenOld, _ := ringOld.MakeJWT(userID, sessionID, time.Hour)
+	tokenRemoved, _ := ringRemoved.MakeJWT(userID, sessionID, time.Hour)
+	tokenExpired, _ := ring.MakeJWT(userID, sessionID, -time.Minute)
+	tokenLegacy, _ := MakeSessionJWT(userID, sessionID, legacySecret, time.Hour)
+
+	// a token claiming HS256 and the kid of the ES256 key, signed with what
+	// a confused verifier would use as the secret
+	tokenConfused := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(userID, sessionID, time.Now(), time.Hour))
+	tokenConfused.Header["kid"] = keyOld.ID
+	tokenAlgorithmMismatch, _ := tokenConfused.SignedString([]byte(keyOld.JWK().X))
+
+	tokenUnsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, newClaims(userID, sessionID, time.Now(), time.Hour)).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	cases := map[string]struct {
+		tokenString string
+		wantErr     bool
+	}{
+		"signed with newest key": {
+			tokenString: tokenNew,
+		},
+		"signed with rotated key": {
+			tokenString: tokenOld,
+		},
+		"signed with legacy secret": {
+			tokenString: tokenLegacy,
+		},
+		"signed with removed key": {
+			tokenString: tokenRemoved,
+			wantErr:     true,
+		},
+		"expired": {
+			tokenString: tokenExpired,
+			wantErr:     true,
+		},
+		"algorithm doesn't match key": {
+			tokenString: tokenAlgorithmMismatch,
+			wantErr:     true,
+		},
+		"unsigned": {
+			tokenString: tokenUnsigned,
+			wantErr:     true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			gotUserID, gotSessionID, err := ring.ValidateJWT(c.tokenString)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("ValidateJWT() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if err == nil && (gotUserID != userID || gotSessionID != sessionID) {
+				t.Errorf("ValidateJWT() got = %v %v, want %v %v", gotUserID, gotSessionID, userID, sessionID)
+			}
+		})
+	}
+
+	t.Run("Test case legacy secret not set", func(t *testing.T) {
+		_, _, err := ringOld.ValidateJWT(tokenLegacy)
+		if err == nil {
+			t.Errorf("ValidateJWT() accepted an HS256 token without a legacy secret")
+		}
+	})
+
+	t.Run("Test case legacy secret past its time", func(t *testing.T) {
+		ringUpgraded := NewKeyRing(legacySecret)
+		ringUpgraded.Load([]*SigningKey{keyNew})
+		ringUpgraded.AcceptLegacyUntil(time.Now().Add(-time.Minute))
+		_, _, err := ringUpgraded.ValidateJWT(tokenLegacy)
+		if !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("ValidateJWT() error = %v, want %v", err, ErrUnknownKey)
+		}
+	})
+
+	t.Run("Test case clock", func(t *testing.T) {
+		now := time.Now().Add(-2 * time.Hour)
+		ringPast := NewKeyRing("")
+		ringPast.Load([]*SigningKey{keyNew})
+		ringPast.Now = func() time.Time { return now }
+
+		tokenPast, err := ringPast.MakeJWT(userID, sessionID, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeJWT() error = %v", err)
+		}
+		_, _, err = ringPast.ValidateJWT(tokenPast)
+		if err != nil {
+			t.Errorf("ValidateJWT() by the clock it was made by error = %v", err)
+		}
+		_, _, err = ring.ValidateJWT(tokenPast)
+		if err == nil {
+			t.Errorf("ValidateJWT() accepted a token that expired an hour ago")
+		}
+	})
+
+	t.Run("Test case key yet to sign", func(t *testing.T) {
+		now := time.Now()
+		keyPending, err := GenerateSigningKey(AlgorithmEdDSA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyPending.SignsAt = now.Add(2 * time.Minute)
+		ringRotated := NewKeyRing("")
+		ringRotated.Load([]*SigningKey{keyPending, keyOld})
+		ringRotated.Now = func() time.Time { return now }
+
+		jwks := ringRotated.JWKS()
+		if len(jwks.Keys) != 2 || jwks.Keys[0].ID != keyOld.ID || jwks.Keys[1].ID != keyPending.ID {
+			t.Errorf("JWKS() = %+v, want %s signing and %s published", jwks.Keys, keyOld.ID, keyPending.ID)
+		}
+
+		// other servers already verify with it before it signs
+		ringPending := NewKeyRing("")
+		ringPending.Load([]*SigningKey{keyPending})
+		tokenPending, _ := ringPending.MakeJWT(userID, sessionID, time.Hour)
+		_, _, err = ringRotated.ValidateJWT(tokenPending)
+		if err != nil {
+			t.Errorf("ValidateJWT() of a key yet to sign error = %v", err)
+		}
+
+		tokenBefore, _ := ringRotated.MakeJWT(userID, sessionID, time.Hour)
+		now = now.Add(2 * time.Minute)
+		tokenAfter, _ := ringRotated.MakeJWT(userID, sessionID, time.Hour)
+		for token, want := range map[string]string{tokenBefore: keyOld.ID, tokenAfter: keyPending.ID} {
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != want {
+				t.Errorf("MakeJWT() signed with %v, want %v", parsed.Header["kid"], want)
+			}
+		}
+	})
+
+	t.Run("Test case OAuth client", func(t *testing.T) {
+		scopes := []Scope{ScopeChirpsRead, ScopeProfileWrite}
+		tokenClient, err := ring.MakeClientJWT(userID, sessionID, "weather-bot", scopes, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeClientJWT() error = %v", err)
+		}
+
+		got, err := ring.ParseJWT(tokenClient)
+		if err != nil {
+			t.Fatalf("ParseJWT() error = %v", err)
+		}
+		if got.UserID != userID || got.SessionID != sessionID || got.ClientID != "weather-bot" || !reflect.DeepEqual(got.Scopes, scopes) {
+			t.Errorf("ParseJWT() got = %+v, want the user, session, client and scopes", got)
+		}
+
+		// a scoped token must never pass for a full login
+		_, _, err = ring.ValidateJWT(tokenClient)
+		if !errors.Is(err, ErrTokenScoped) {
+			t.Errorf("ValidateJWT() error = %v, want %v", err, ErrTokenScoped)
+		}
+
+		got, err = ring.ParseJWT(tokenNew)
+		if err != nil || got.ClientID != "" || got.Scopes != nil {
+			t.Errorf("ParseJWT() got = %+v, %v, want a login token without scopes", got, err)
+		}
+	})
+
+	t.Run("Test case JWKS", func(t *testing.T) {
+		jwks := ring.JWKS()
+		if len(jwks.Keys) != 2 || jwks.Keys[0].ID != keyNew.ID || jwks.Keys[1].ID != keyOld.ID {
+			t.Errorf("JWKS() got = %+v, want the new then the old key", jwks.Keys)
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password doesn't match")
+	ErrHashUnknown      = errors.New("unknown password hash format")
+)
+
+// PasswordHasher hashes passwords in one format.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Check(password, hash string) error
+	// Owns reports whether the hash is in the format of the hasher.
+	Owns(hash string) bool
+	// NeedsRehash reports whether the hash was made with other parameters
+	// than the hasher's.
+	NeedsRehash(hash string) bool
+}
+
+// Passwords hashes new passwords with Current and checks them against hashes
+// of any of its hashers, so old hashes can be replaced as users log in.
+type Passwords struct {
+	Current PasswordHasher
+	Legacy  []PasswordHasher
+}
+
+// NewPasswords hashes with argon2id, checking bcrypt hashes from before.
+func NewPasswords(params Argon2idParams) *Passwords {
+	return &Passwords{
+		Current: Argon2id{Params: params},
+		Legacy:  []PasswordHasher{Bcrypt{Cost: BcryptCost}},
+	}
+}
+
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.Current.Hash(password)
+}
+
+// Check checks the password against the hash, reporting whether the hash
+// is outdated and should be replaced with a new Hash of the password.
+func (p *Passwords) Check(password, hash string) (bool, error) {
+	if p.Current.Owns(hash) {
+		err := p.Current.Check(password, hash)
+		return err == nil && p.Current.NeedsRehash(hash), err
+	}
+	for _, hasher := range p.Legacy {
+		if hasher.Owns(hash) {
+			err := hasher.Check(password, hash)
+			return err == nil, err
+		}
+	}
+	return false, ErrHashUnknown
+}
+
+// Argon2idParams are the costs of an argon2id hash. Memory is in KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams are the second recommended option of RFC 9106, for
+// when 2 GiB of memory per hash is too much.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2id hashes passwords with argon2id into PHC strings like
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>.
+type Argon2id struct {
+	Params Argon2idParams
+}
+
+const argon2idPrefix = "$argon2id$"
+
+func (h Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version,
+		h.Params.Memory, h.Params.Iterations, h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2id) Check(password, hash string) error {
+	params, salt, key, err := argon2idParse(hash)
+	if err != nil {
+		return err
+	}
+
+	got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h Argon2id) Owns(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix)
+}
+
+func (h Argon2id) NeedsRehash(hash string) bool {
+	params, salt, key, err := argon2idParse(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Params.Memory ||
+		params.Iterations != h.Params.Iterations ||
+		params.Parallelism != h.Params.Parallelism ||
+		uint32(len(salt)) != h.Params.SaltLength ||
+		uint32(len(key)) != h.Params.KeyLength
+}
+
+func argon2idParse(hash string) (Argon2idParams, []byte, []byte, error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) != 6 || fields[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, ErrHashUnknown
+	}
+
+	var version int
+	_, err := fmt.Sscanf(fields[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("unsupported argon2id version %q", fields[2])
+	}
+
+	params := Argon2idParams{}
+	_, err = fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id parameters %q", fields[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) == 0 {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// BcryptCost is the cost passwords used to be hashed with.
+const BcryptCost = 8
+
+// Bcrypt hashes passwords with bcrypt, which ignores all but the first 72
+// bytes of a password. Only kept to check hashes from before argon2id.
+type Bcrypt struct {
+	Cost int
+}
+
+func (h Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h Bcrypt) Check(password, hash string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h Bcrypt) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h Bcrypt) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
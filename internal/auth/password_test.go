@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testArgon2idParams keep the tests fast, never use them for real.
+var testArgon2idParams = Argon2idParams{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestArgon2idFormat(t *testing.T) {
+	hash, err := Argon2id{Params: testArgon2idParams}.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	phc := regexp.MustCompile(`^\$argon2id\$v=19\$m=64,t=1,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`)
+	if !phc.MatchString(hash) {
+		t.Errorf("Hash() got = %v, want a PHC string", hash)
+	}
+
+	other, _ := Argon2id{Params: testArgon2idParams}.Hash("hunter2")
+	if other == hash {
+		t.Errorf("Hash() got the same hash twice, the salt isn't random")
+	}
+}
+
+func TestPasswordsCheck(t *testing.T) {
+	const password = "one of the passwords of all time fr fr"
+	// bcrypt only reads the first 72 bytes
+	long := strings.Repeat("a", 72)
+
+	passwords := NewPasswords(testArgon2idParams)
+	stronger := NewPasswords(Argon2idParams{
+		Memory:      128,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	})
+
+	hashArgon2id, err := passwords.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	hashBcrypt, err := Bcrypt{Cost: BcryptCost}.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	hashBcryptCheap, _ := Bcrypt{Cost: 4}.Hash(password)
+	hashLong, _ := passwords.Hash(long + "b")
+
+	cases := map[string]struct {
+		passwords  *Passwords
+		password   string
+		hash       string
+		wantRehash bool
+		wantErr    bool
+	}{
+		"argon2id": {
+			passwords: passwords,
+			password:  password,
+			hash:      hashArgon2id,
+		},
+		"argon2id wrong password": {
+			passwords: passwords,
+			password:  "woops",
+			hash:      hashArgon2id,
+			wantErr:   true,
+		},
+		"argon2id with weaker parameters": {
+			passwords:  stronger,
+			password:   password,
+			hash:       hashArgon2id,
+			wantRehash: true,
+		},
+		"argon2id past 72 bytes": {
+			passwords: passwords,
+			password:  long + "c",
+			hash:      hashLong,
+			wantErr:   true,
+		},
+		"bcrypt": {
+			passwords:  passwords,
+			password:   password,
+			hash:       hashBcrypt,
+			wantRehash: true,
+		},
+		"bcrypt with another cost": {
+			passwords:  passwords,
+			password:   password,
+			hash:       hashBcryptCheap,
+			wantRehash: true,
+		},
+		"bcrypt wrong password": {
+			passwords: passwords,
+			password:  "woops",
+			hash:      hashBcrypt,
+			wantErr:   true,
+		},
+		"unknown hash": {
+			passwords: passwords,
+			password:  password,
+			hash:      "wooOOOOOooooo00000000000oo",
+			wantErr:   true,
+		},
+		"broken argon2id hash": {
+			passwords: passwords,
+			password:  password,
+			hash:      "$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5",
+			wantErr:   true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			gotRehash, err := c.passwords.Check(c.password, c.hash)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if gotRehash != c.wantRehash {
+				t.Errorf("Check() gotRehash = %v, want %v", gotRehash, c.wantRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// PKCEChallenge returns the S256 code challenge of a PKCE code verifier,
+// RFC 7636. The plain method isn't supported, it protects nothing once the
+// authorization request is seen.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidPKCEVerifier reports whether the code verifier is 43 to 128 of the
+// characters RFC 7636 allows.
+func ValidPKCEVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, r := range verifier {
+		unreserved := 'A' <= r && r <= 'Z' || 'a' <= r && r <= 'z' || '0' <= r && r <= '9' ||
+			r == '-' || r == '.' || r == '_' || r == '~'
+		if !unreserved {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidPKCEChallenge reports whether the code challenge is an S256 one, the
+// 43 characters of a base64url encoded SHA-256 hash.
+func ValidPKCEChallenge(challenge string) bool {
+	sum, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(sum) == sha256.Size
+}
+
+// CheckPKCE checks the code verifier against the S256 code challenge.
+func CheckPKCE(verifier, challenge string) bool {
+	if !ValidPKCEVerifier(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Fatalf("PKCEChallenge() got = %v, want %v", got, challenge)
+	}
+	if !ValidPKCEChallenge(challenge) {
+		t.Errorf("ValidPKCEChallenge() got = false, want true")
+	}
+
+	cases := map[string]struct {
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		"matching": {
+			verifier:  verifier,
+			challenge: challenge,
+			want:      true,
+		},
+		"other verifier": {
+			verifier:  strings.Repeat("a", 43),
+			challenge: challenge,
+		},
+		"plain": {
+			verifier:  verifier,
+			challenge: verifier,
+		},
+		"too short": {
+			verifier:  "abc",
+			challenge: PKCEChallenge("abc"),
+		},
+		"too long": {
+			verifier:  strings.Repeat("a", 129),
+			challenge: PKCEChallenge(strings.Repeat("a", 129)),
+		},
+		"reserved characters": {
+			verifier:  strings.Repeat("a", 42) + "/",
+			challenge: PKCEChallenge(strings.Repeat("a", 42) + "/"),
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			if got := CheckPKCE(c.verifier, c.challenge); got != c.want {
+				t.Errorf("CheckPKCE() got = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// PasswordRule names a rule of a PasswordPolicy, for clients to tell which
+// ones a password broke.
+type PasswordRule string
+
+const (
+	RuleRequired  PasswordRule = "required"
+	RuleMinLength PasswordRule = "min_length"
+	RuleMaxLength PasswordRule = "max_length"
+	RuleStrength  PasswordRule = "strength"
+	RuleNotEmail  PasswordRule = "not_email"
+	RuleBreached  PasswordRule = "breached"
+)
+
+// PasswordViolation is a rule a password broke.
+type PasswordViolation struct {
+	Rule    PasswordRule `json:"rule"`
+	Message string       `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password broke, not just the first,
+// so it can be fixed in one go.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// BreachedList is a set of passwords known from data breaches.
+type BreachedList interface {
+	Contains(password string) bool
+}
+
+// PasswordPolicy is what a new password has to be.
+type PasswordPolicy struct {
+	// MinLength and MaxLength count characters, not bytes. A MaxLength of 0
+	// is no limit.
+	MinLength int
+	MaxLength int
+	// MinStrength is the least PasswordStrength score accepted, 0 to 4.
+	MinStrength int
+	// Breached, when set, rejects passwords on the list.
+	Breached BreachedList
+}
+
+// DefaultPasswordPolicy asks for 8 characters of at least fair strength. The
+// maximum keeps hashing cheap enough that long passwords can't slow the
+// server down.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:   8,
+	MaxLength:   256,
+	MinStrength: 2,
+}
+
+// Check checks a new password for the account with the email, returning a
+// *PasswordPolicyError with every rule it broke.
+func (p PasswordPolicy) Check(password, email string) error {
+	if password == "" {
+		return &PasswordPolicyError{Violations: []PasswordViolation{
+			{Rule: RuleRequired, Message: "password is required"},
+		}}
+	}
+
+	violations := []PasswordViolation{}
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("password must be at most %d characters long", p.MaxLength),
+		})
+	}
+	if email != "" && strings.EqualFold(strings.TrimSpace(password), strings.TrimSpace(email)) {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleNotEmail,
+			Message: "password can't be the email address",
+		})
+	}
+	if p.MinStrength > 0 && PasswordStrength(password, emailInputs(email)...) < p.MinStrength {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleStrength,
+			Message: "password is too easy to guess, try a longer one or a few uncommon words",
+		})
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleBreached,
+			Message: "password appeared in a data breach, choose another one",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// emailInputs splits an email into the words someone guessing the password
+// of its owner would try first, like "john" and "doe" of john.doe@mail.com.
+func emailInputs(email string) []string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil
+	}
+	inputs := []string{email}
+	local, domain, _ := strings.Cut(email, "@")
+	inputs = append(inputs, local)
+	inputs = append(inputs, strings.FieldsFunc(local, notAlphanumeric)...)
+	labels := strings.Split(domain, ".")
+	if len(labels) > 1 {
+		labels = labels[:len(labels)-1]
+	}
+	return append(inputs, labels...)
+}
+
+func notAlphanumeric(r rune) bool {
+	return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+}
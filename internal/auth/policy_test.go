@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasswordStrength(t *testing.T) {
+	cases := map[string]struct {
+		password    string
+		userInputs  []string
+		wantMinimum int
+		wantMaximum int
+	}{
+		"common password": {
+			password:    "password",
+			wantMaximum: 0,
+		},
+		"common password capitalized with a digit": {
+			password:    "Password1",
+			wantMaximum: 0,
+		},
+		"l33t common password": {
+			password:    "p@ssw0rd",
+			wantMaximum: 1,
+		},
+		"keyboard row": {
+			password:    "qwertyuiop",
+			wantMaximum: 0,
+		},
+		"reversed keyboard row": {
+			password:    "poiuytrewq",
+			wantMaximum: 0,
+		},
+		"sequence": {
+			password:    "abcdefghijkl",
+			wantMaximum: 0,
+		},
+		"repeat": {
+			password:    "aaaaaaaaaaaaaaaa",
+			wantMaximum: 0,
+		},
+		"repeated word": {
+			password:    "monkeymonkeymonkey",
+			wantMaximum: 1,
+		},
+		"word and year": {
+			password:    "iloveyou2024",
+			wantMaximum: 1,
+		},
+		"user inputs": {
+			password:    "johndoe1985",
+			userInputs:  emailInputs("john.doe@example.com"),
+			wantMaximum: 1,
+		},
+		"passphrase": {
+			password:    "correcthorsebatterystaple",
+			wantMinimum: 4,
+			wantMaximum: 4,
+		},
+		"random": {
+			password:    "x7#kP9!qL2@m",
+			wantMinimum: 4,
+			wantMaximum: 4,
+		},
+		"long": {
+			password:    strings.Repeat("ab1", 40) + "zq8#",
+			wantMinimum: 3,
+			wantMaximum: 4,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got := PasswordStrength(c.password, c.userInputs...)
+			if got < c.wantMinimum || got > c.wantMaximum {
+				t.Errorf("PasswordStrength() got = %v, want %v to %v", got, c.wantMinimum, c.wantMaximum)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	breached, err := NewBloomFilter(10, 0.001)
+	if err != nil {
+		t.Fatalf("NewBloomFilter() error = %v", err)
+	}
+	breached.Add("xk8#pLq2!vZm")
+
+	policy := DefaultPasswordPolicy
+	policy.Breached = breached
+
+	cases := map[string]struct {
+		password  string
+		email     string
+		wantRules []PasswordRule
+	}{
+		"strong": {
+			password: "gravel-otter-lantern-9",
+			email:    "john@example.com",
+		},
+		"empty": {
+			password:  "",
+			email:     "john@example.com",
+			wantRules: []PasswordRule{RuleRequired},
+		},
+		"short and weak": {
+			password:  "abc",
+			email:     "john@example.com",
+			wantRules: []PasswordRule{RuleMinLength, RuleStrength},
+		},
+		"too long": {
+			password:  strings.Repeat("gravel-otter-", 20),
+			email:     "john@example.com",
+			wantRules: []PasswordRule{RuleMaxLength},
+		},
+		"the email": {
+			password:  "John.Doe@example.com",
+			email:     "john.doe@example.com",
+			wantRules: []PasswordRule{RuleNotEmail, RuleStrength},
+		},
+		"breached": {
+			password:  "xk8#pLq2!vZm",
+			email:     "john@example.com",
+			wantRules: []PasswordRule{RuleBreached},
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			err := policy.Check(c.password, c.email)
+			if c.wantRules == nil {
+				if err != nil {
+					t.Fatalf("Check() error = %v, want none", err)
+				}
+				return
+			}
+
+			policyErr := &PasswordPolicyError{}
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Check() error = %v, want a PasswordPolicyError", err)
+			}
+			gotRules := []PasswordRule{}
+			for _, violation := range policyErr.Violations {
+				gotRules = append(gotRules, violation.Rule)
+			}
+			if !reflect.DeepEqual(gotRules, c.wantRules) {
+				t.Errorf("Check() got rules = %v, want %v", gotRules, c.wantRules)
+			}
+		})
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter, err := NewBloomFilter(1000, 0.001)
+	if err != nil {
+		t.Fatalf("NewBloomFilter() error = %v", err)
+	}
+	filter.Add("hunter2")
+	// SHA-1 of "password", as Have I Been Pwned lists it
+	err = filter.AddSHA1Hex("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8")
+	if err != nil {
+		t.Fatalf("AddSHA1Hex() error = %v", err)
+	}
+	for i := range 998 {
+		filter.Add(fmt.Sprintf("breached-%d", i))
+	}
+
+	buf := bytes.Buffer{}
+	_, err = filter.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	read, err := ReadBloomFilter(&buf)
+	if err != nil {
+		t.Fatalf("ReadBloomFilter() error = %v", err)
+	}
+
+	for _, password := range []string{"hunter2", "password", "breached-0", "breached-997"} {
+		if !read.Contains(password) {
+			t.Errorf("Contains(%q) got = false, want true", password)
+		}
+	}
+	falsePositives := 0
+	for i := range 10000 {
+		if read.Contains(fmt.Sprintf("fine-%d", i)) {
+			falsePositives++
+		}
+	}
+	// 10 expected at 0.001, leaving room for bad luck
+	if falsePositives > 40 {
+		t.Errorf("Contains() got %d false positives out of 10000, want about 10", falsePositives)
+	}
+
+	cases := map[string]struct {
+		file string
+	}{
+		"empty":       {file: ""},
+		"not a bloom": {file: "hello there, general kenobi"},
+		"truncated":   {file: bloomMagic + "\x00\x00\x00\x00\x00\x00\x00\x40\x00\x00\x00\x01\x00"},
+		"no hashes":   {file: bloomMagic + "\x00\x00\x00\x00\x00\x00\x00\x40\x00\x00\x00\x00" + strings.Repeat("\x00", 8)},
+	}
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			_, err := ReadBloomFilter(strings.NewReader(c.file))
+			if err == nil {
+				t.Errorf("ReadBloomFilter() error = nil, want an error")
+			}
+		})
+	}
+}
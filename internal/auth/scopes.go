@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scope is something a credential short of a full login, like an API key,
+// is allowed to do.
+type Scope string
+
+const (
+	ScopeChirpsRead   Scope = "chirps:read"
+	ScopeChirpsWrite  Scope = "chirps:write"
+	ScopeProfileWrite Scope = "profile:write"
+)
+
+// Scopes are all the scopes there are.
+var Scopes = []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// ParseScopes checks the names are scopes, dropping repeats.
+func ParseScopes(names []string) ([]Scope, error) {
+	scopes := []Scope{}
+	for _, name := range names {
+		scope := Scope(name)
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", name)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// ScopeString joins scopes the way OAuth does, separated by spaces.
+func ScopeString(scopes []Scope) string {
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, string(scope))
+	}
+	return strings.Join(names, " ")
+}
+
+// APIKeyPrefix starts every API key of a user, so leaked keys are easy to
+// spot in code and logs.
+const APIKeyPrefix = "chirpy_"
+
+// MakeAPIKey makes an API key, returning along with it the prefix shown to
+// tell keys apart without revealing them. Keys are stored like tokens, as
+// their HashToken.
+func MakeAPIKey() (string, string, error) {
+	keyRaw := make([]byte, 32)
+	_, err := rand.Read(keyRaw)
+	if err != nil {
+		return "", "", err
+	}
+	key := APIKeyPrefix + hex.EncodeToString(keyRaw)
+	return key, key[:len(APIKeyPrefix)+8], nil
+}
+
+// IsUserAPIKey reports whether the key looks like one from MakeAPIKey, rather
+// than a key of a service like Polka.
+func IsUserAPIKey(key string) bool {
+	return strings.HasPrefix(key, APIKeyPrefix)
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	cases := map[string]struct {
+		names   []string
+		want    []Scope
+		wantErr bool
+	}{
+		"none": {
+			names: []string{},
+			want:  []Scope{},
+		},
+		"some": {
+			names: []string{"chirps:write", "chirps:read"},
+			want:  []Scope{ScopeChirpsWrite, ScopeChirpsRead},
+		},
+		"repeated": {
+			names: []string{"profile:write", "profile:write"},
+			want:  []Scope{ScopeProfileWrite},
+		},
+		"unknown": {
+			names:   []string{"chirps:read", "admin"},
+			wantErr: true,
+		},
+		"wrong case": {
+			names:   []string{"Chirps:Read"},
+			wantErr: true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got, err := ParseScopes(c.names)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("ParseScopes() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+				t.Errorf("ParseScopes() got = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMakeAPIKey(t *testing.T) {
+	key, prefix, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() error = %v", err)
+	}
+	if !IsUserAPIKey(key) || len(key) != len(APIKeyPrefix)+64 {
+		t.Errorf("MakeAPIKey() got key = %v, want %s and 64 hex digits", key, APIKeyPrefix)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) != len(APIKeyPrefix)+8 {
+		t.Errorf("MakeAPIKey() got prefix = %v, want the start of %v", prefix, key)
+	}
+
+	other, _, _ := MakeAPIKey()
+	if other == key {
+		t.Errorf("MakeAPIKey() got the same key twice")
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SecretBoxKeySize is how many bytes the key of a SecretBox has.
+const SecretBoxKeySize = 32
+
+// sealedPrefix marks sealed secrets, and the format they're sealed in.
+const sealedPrefix = "v1:"
+
+var (
+	ErrSecretNotSealed = errors.New("secret isn't sealed")
+	ErrSecretOpen      = errors.New("secret can't be opened with this key")
+)
+
+// SecretBox seals secrets the server has to read back, like signing keys and
+// two-factor secrets, before they're stored, so reading the database isn't
+// enough to use them. It's AES-256-GCM under a key kept out of the database.
+// A secret is sealed for what it belongs to and only opens for the same, so
+// it can't be copied over to another row either.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+func NewSecretBox(key []byte) (*SecretBox, error) {
+	if len(key) != SecretBoxKeySize {
+		return nil, fmt.Errorf("secret box key must be %d bytes, got %d", SecretBoxKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// Seal encrypts the secret for what it belongs to, like the row it's kept in.
+func (b *SecretBox) Seal(secret, belongsTo string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(secret), []byte(belongsTo))
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret sealed for what it belongs to.
+func (b *SecretBox) Open(sealed, belongsTo string) (string, error) {
+	encoded, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return "", ErrSecretNotSealed
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return "", ErrSecretOpen
+	}
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	secret, err := b.aead.Open(nil, nonce, ciphertext, []byte(belongsTo))
+	if err != nil {
+		return "", ErrSecretOpen
+	}
+	return string(secret), nil
+}
+
+// IsSealed tells whether the value is a sealed secret, rather than one kept
+// in the clear from before secrets were sealed.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSecretBox(t *testing.T) {
+	box, err := NewSecretBox(bytes.Repeat([]byte{1}, SecretBoxKeySize))
+	if err != nil {
+		t.Fatalf("NewSecretBox() error = %v", err)
+	}
+	boxOther, err := NewSecretBox(bytes.Repeat([]byte{2}, SecretBoxKeySize))
+	if err != nil {
+		t.Fatalf("NewSecretBox() error = %v", err)
+	}
+
+	const secret = "JBSWY3DPEHPK3PXP"
+	sealed, err := box.Seal(secret, "user 1")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, secret) {
+		t.Fatalf("Seal() got = %q, want the secret sealed", sealed)
+	}
+	if again, _ := box.Seal(secret, "user 1"); again == sealed {
+		t.Errorf("Seal() sealed the same secret the same way twice")
+	}
+
+	cases := map[string]struct {
+		box       *SecretBox
+		sealed    string
+		belongsTo string
+		wantErr   error
+	}{
+		"sealed": {
+			box:       box,
+			sealed:    sealed,
+			belongsTo: "user 1",
+		},
+		"sealed for another": {
+			box:       box,
+			sealed:    sealed,
+			belongsTo: "user 2",
+			wantErr:   ErrSecretOpen,
+		},
+		"other key": {
+			box:       boxOther,
+			sealed:    sealed,
+			belongsTo: "user 1",
+			wantErr:   ErrSecretOpen,
+		},
+		"tampered": {
+			box:       box,
+			sealed:    sealed[:len(sealed)-2] + "AA",
+			belongsTo: "user 1",
+			wantErr:   ErrSecretOpen,
+		},
+		"too short": {
+			box:       box,
+			sealed:    sealedPrefix + "AAAA",
+			belongsTo: "user 1",
+			wantErr:   ErrSecretOpen,
+		},
+		"in the clear": {
+			box:       box,
+			sealed:    secret,
+			belongsTo: "user 1",
+			wantErr:   ErrSecretNotSealed,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got, err := c.box.Open(c.sealed, c.belongsTo)
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("Open() error = %v, want %v", err, c.wantErr)
+			}
+			if c.wantErr == nil && got != secret {
+				t.Errorf("Open() got = %q, want %q", got, secret)
+			}
+		})
+	}
+
+	_, err = NewSecretBox([]byte("too short"))
+	if err == nil {
+		t.Errorf("NewSecretBox() with a short key got no error")
+	}
+}
@@ -0,0 +1,402 @@
+package auth
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PasswordStrength scores how hard the password is to guess, from 0, too
+// guessable, to 4, very unguessable, like zxcvbn does. The password is built
+// from the patterns an attacker tries first, common passwords and words, the
+// user's own details given as userInputs, keyboard rows, sequences, repeats
+// and years, in the way needing the fewest guesses, and guessed character by
+// character where nothing fits.
+func PasswordStrength(password string, userInputs ...string) int {
+	guesses := passwordGuesses(password, userInputs)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// strengthRunesMax is how much of a password is looked at for patterns, the
+// estimate takes time cubic in the length. Anything beyond is brute forced.
+const strengthRunesMax = 100
+
+// passwordGuesses estimates the log10 of the number of guesses it takes to
+// find the password.
+func passwordGuesses(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	extra := 0.0
+	if len(runes) > strengthRunesMax {
+		extra = float64(len(runes) - strengthRunesMax)
+		runes = runes[:strengthRunesMax]
+	}
+	n := len(runes)
+	if n == 0 {
+		return 0
+	}
+
+	dictionary := rankedDictionary
+	if len(userInputs) > 0 {
+		dictionary = make(map[string]int, len(rankedDictionary)+len(userInputs))
+		for word, rank := range rankedDictionary {
+			dictionary[word] = rank + len(userInputs)
+		}
+		for i, input := range userInputs {
+			input = strings.ToLower(input)
+			if len([]rune(input)) < 3 {
+				continue
+			}
+			if _, ok := dictionary[input]; !ok || dictionary[input] > i+1 {
+				dictionary[input] = i + 1
+			}
+		}
+	}
+
+	e := strengthEstimator{runes: runes, dictionary: dictionary}
+	e.lower = make([]rune, n)
+	for i, r := range runes {
+		e.lower[i] = unicode.ToLower(r)
+	}
+	e.segments = make([][]float64, n+1)
+	for i := range e.segments {
+		e.segments[i] = make([]float64, n+1)
+	}
+	// shorter segments first, repeats look up the guesses of their chunk
+	for length := 1; length <= n; length++ {
+		for i := 0; i+length <= n; i++ {
+			e.segments[i][i+length] = e.segmentGuesses(i, i+length)
+		}
+	}
+
+	// best[j][l] is the fewest guesses for runes[:j] split into l segments.
+	// Splits into more segments take more guesses to put together, the
+	// attacker doesn't know in which order the patterns come.
+	best := make([][]float64, n+1)
+	for j := range best {
+		best[j] = make([]float64, n+1)
+		for l := range best[j] {
+			best[j][l] = math.Inf(1)
+		}
+	}
+	best[0][0] = 0
+	for j := 1; j <= n; j++ {
+		for i := 0; i < j; i++ {
+			guesses := e.segments[i][j]
+			if i > 0 || j < n {
+				guesses = math.Max(guesses, segmentGuessesMin(j-i))
+			}
+			for l := 1; l <= i+1; l++ {
+				best[j][l] = math.Min(best[j][l], best[i][l-1]+guesses)
+			}
+		}
+	}
+
+	fewest := math.Inf(1)
+	factorial := 0.0
+	for l := 1; l <= n; l++ {
+		factorial += math.Log10(float64(l))
+		fewest = math.Min(fewest, best[n][l]+factorial)
+	}
+	return fewest + extra
+}
+
+// segmentGuessesMin is the least log10 guesses a segment of a longer
+// password takes, however obvious it is on its own.
+func segmentGuessesMin(length int) float64 {
+	if length == 1 {
+		return 1
+	}
+	return math.Log10(50)
+}
+
+type strengthEstimator struct {
+	runes      []rune
+	lower      []rune
+	dictionary map[string]int
+	// segments[i][j] is the fewest log10 guesses of runes[i:j] as a single
+	// pattern.
+	segments [][]float64
+}
+
+func (e *strengthEstimator) segmentGuesses(i, j int) float64 {
+	length := j - i
+	guesses := float64(length) // brute force, 10 guesses a character
+	if length == 1 {
+		guesses = math.Log10(11)
+	}
+
+	word := string(e.lower[i:j])
+	if rank, ok := e.dictionary[word]; ok {
+		guesses = math.Min(guesses, math.Log10(float64(rank))+uppercaseVariations(e.runes[i:j]))
+	}
+	if rank, ok := e.dictionary[reverse(word)]; ok {
+		guesses = math.Min(guesses, math.Log10(float64(rank)*2)+uppercaseVariations(e.runes[i:j]))
+	}
+	if unleeted, subs := unleet(e.lower[i:j]); subs > 0 {
+		if rank, ok := e.dictionary[unleeted]; ok {
+			guesses = math.Min(guesses, math.Log10(float64(rank))+float64(subs)*math.Log10(2)+uppercaseVariations(e.runes[i:j]))
+		}
+	}
+
+	if length >= 2 {
+		guesses = math.Min(guesses, e.repeatGuesses(i, j))
+	}
+	if length >= 3 {
+		guesses = math.Min(guesses, sequenceGuesses(e.runes[i:j]))
+		guesses = math.Min(guesses, keyboardGuesses(word))
+	}
+	if length == 4 {
+		guesses = math.Min(guesses, yearGuesses(word))
+	}
+	return guesses
+}
+
+// repeatGuesses is for runes[i:j] repeating a shorter chunk, like "aaa" or
+// "abcabc": guessing the chunk, then how many times it repeats.
+func (e *strengthEstimator) repeatGuesses(i, j int) float64 {
+	length := j - i
+	for period := 1; period <= length/2; period++ {
+		if length%period != 0 {
+			continue
+		}
+		repeats := true
+		for k := i + period; k < j; k++ {
+			if e.runes[k] != e.runes[k-period] {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			return e.segments[i][i+period] + math.Log10(float64(length/period))
+		}
+	}
+	return math.Inf(1)
+}
+
+// sequenceGuesses is for runs like "abcd", "9876" or "mnop": guessing the
+// first character, the length and the direction.
+func sequenceGuesses(runes []rune) float64 {
+	delta := runes[1] - runes[0]
+	if delta != 1 && delta != -1 {
+		return math.Inf(1)
+	}
+	for k := 2; k < len(runes); k++ {
+		if runes[k]-runes[k-1] != delta {
+			return math.Inf(1)
+		}
+	}
+
+	first := runes[0]
+	base := 26.0
+	switch {
+	case strings.ContainsRune("aAzZ019", first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	case unicode.IsUpper(first):
+		base = 52
+	case !unicode.IsLower(first):
+		base = 100
+	}
+	if delta < 0 {
+		base *= 2
+	}
+	return math.Log10(base * float64(len(runes)))
+}
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"~!@#$%^&*()_+",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+// keyboardGuesses is for runs along a keyboard row, like "qwerty" or
+// "lkjh": guessing where it starts, the length and the direction.
+func keyboardGuesses(word string) float64 {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, word) {
+			return math.Log10(47 * float64(len(word)))
+		}
+		if strings.Contains(row, reverse(word)) {
+			return math.Log10(2 * 47 * float64(len(word)))
+		}
+	}
+	return math.Inf(1)
+}
+
+// yearGuesses is for years, guessed from the current one outwards.
+func yearGuesses(word string) float64 {
+	year := 0
+	for _, r := range word {
+		if r < '0' || r > '9' {
+			return math.Inf(1)
+		}
+		year = year*10 + int(r-'0')
+	}
+	if year < 1900 || year > 2099 {
+		return math.Inf(1)
+	}
+	distance := year - time.Now().Year()
+	if distance < 0 {
+		distance = -distance
+	}
+	return math.Log10(math.Max(float64(distance), 20))
+}
+
+// uppercaseVariations is the log10 of the ways the word could be
+// capitalized, starting with the usual ones: "Word", "WORD" and "worD".
+func uppercaseVariations(runes []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 0
+	}
+	if lower == 0 || upper == 1 && (unicode.IsUpper(runes[0]) || unicode.IsUpper(runes[len(runes)-1])) {
+		return math.Log10(2)
+	}
+	variations := 0.0
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return math.Log10(variations)
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// unleet undoes l33t speak, "p@ssw0rd" is "password" with 2 substitutions.
+func unleet(runes []rune) (string, int) {
+	buf := make([]rune, len(runes))
+	subs := 0
+	for i, r := range runes {
+		if sub, ok := leetSubstitutions[r]; ok {
+			r = sub
+			subs++
+		}
+		buf[i] = r
+	}
+	return string(buf), subs
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// rankedDictionary ranks common passwords and words by how early an attacker
+// tries them.
+var rankedDictionary = func() map[string]int {
+	words := strings.Fields(commonPasswords + commonWords)
+	dictionary := make(map[string]int, len(words))
+	for i, word := range words {
+		if _, ok := dictionary[word]; !ok {
+			dictionary[word] = i + 1
+		}
+	}
+	return dictionary
+}()
+
+// commonPasswords are the most used passwords, most used first.
+const commonPasswords = `
+123456 password 12345678 qwerty 123456789 12345 1234 111111 1234567 dragon
+123123 baseball abc123 football monkey letmein 696969 shadow master 666666
+qwertyuiop 123321 mustang 1234567890 michael 654321 superman 1qaz2wsx
+7777777 121212 000000 qazwsx 123qwe killer trustno1 jordan jennifer zxcvbnm
+asdfgh hunter buster soccer harley batman andrew tigger sunshine iloveyou
+2000 charlie robert thomas hockey ranger daniel starwars klaster 112233
+george computer michelle jessica pepper 1111 zxcvbn 555555 11111111 131313
+freedom 777777 pass maggie 159753 aaaaaa ginger princess joshua cheese
+amanda summer love ashley nicole chelsea matthew access yankees 987654321
+dallas austin thunder taylor matrix william corvette hello martin heather
+secret merlin diamond 1234qwer gfhjkm hammer silver 222222 88888888 anthony
+justin test bailey q1w2e3r4t5 patrick internet scooter orange 11111 golfer
+cookie richard samantha bigdog guitar jackson whatever mickey chicken sparky
+snoopy maverick phoenix camaro peanut morgan welcome falcon cowboy ferrari
+samsung andrea smokey steelers joseph mercedes dakota arsenal eagles melissa
+boomer booboo spider nascar monster tigers yellow xxxxxx 123123123 gateway
+marina diablo bulldog qwer1234 compaq purple banana junior hannah 123654
+porsche lakers iceman money cowboys 987654 london tennis 999999 ncc1701
+coffee scooby 0000 miller boston q1w2e3r4 brandon yamaha chester mother
+forever johnny edward 333333 oliver redsox player nikita knight fender
+barney midnight please brandy chicago badboy slayer rangers charles angel
+flower bigdaddy rabbit wizard jasper enter rachel chris steven winner adidas
+victoria natasha 1q2w3e4r jasmine winter prince marine ghbdtn fishing
+cocacola casper james 232323 raiders 888888 marlboro gandalf asdfasdf
+crystal 87654321 12344321 golden 8675309 apple carlos lovely password1
+password123 passw0rd qwerty123 iloveyou1 welcome1 letmein1 changeme default
+admin administrator login abc12345 chirpy chirp chirps
+`
+
+// commonWords are common English words, most used first.
+const commonWords = `
+the and you that was for are with his they this have from one had word but
+not what all were when your can said there use each which she how their
+will other about out many then them these some her would make like him into
+time has look two more write see number way could people than first water
+been call who now find long down day did get come made may part over new
+sound take only little work know place year live back give most very after
+thing our just name good sentence man think say great where help through
+much before line right too mean old any same tell boy follow came want show
+also around form three small set put end does another well large must big
+even such because turn here why ask went men read need land different home
+move try kind hand picture again change off play spell air away animal house
+point page letter mother answer found study still learn should world high
+every near add food between own below country plant last school father keep
+tree never start city earth eye light thought head under story saw left few
+while along might close something seem next hard open example begin life
+always those both paper together got group often run important until
+children side feet car mile night walk white sea began grow took river four
+carry state once book hear stop without second later miss idea enough eat
+face watch far really almost let above girl sometimes mountain cut young
+talk soon list song being leave family body music color stand sun question
+fish area mark dog horse birds problem complete room knew since ever piece
+told usually friends easy heard order red door sure become top ship across
+today during short better best however low hours black products happened
+whole measure remember early waves reached listen wind rock space covered
+fast several hold himself toward five step morning passed vowel true hundred
+against pattern numeral table north slowly money map farm pulled draw voice
+seen cold cried plan notice south sing war ground fall king town unit figure
+certain field travel wood fire upon done english road half ten fly gave box
+finally wait correct oh quickly person became shown minutes strong verb
+stars front feel fact inches street decided contain course surface produce
+building ocean class note nothing rest carefully scientists inside wheels
+stay green known island week less machine base ago stood plane system behind
+ran round boat game force brought understand warm common bring explain dry
+though language shape deep thousands yes clear equation yet government
+filled heat full hot check object bread rule among noun power cannot able
+six size dark ball material special heavy fine pair circle include built
+battery staple cat moon blue happy magic dream sky summer
+`
@@ -0,0 +1,160 @@
+package chirptext
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const hashtagLenMax = 100
+
+// URLLength is how much every URL adds to the Length of a chirp, however long
+// it is.
+const URLLength = 23
+
+var urlRegexp = regexp.MustCompile(`(?i)\bhttps?://[^\s]*[^\s.,:;!?'")\]]`)
+
+// Length is the length of a chirp body as people read it, in grapheme
+// clusters, so "👍🏽" and "é" count as one character no matter how many code
+// points they are made of. Every http or https URL counts as URLLength.
+func Length(body string) int {
+	length := 0
+	last := 0
+	for _, loc := range urlRegexp.FindAllStringIndex(body, -1) {
+		length += uniseg.GraphemeClusterCount(body[last:loc[0]]) + URLLength
+		last = loc[1]
+	}
+	return length + uniseg.GraphemeClusterCount(body[last:])
+}
+
+// Hashtags returns the distinct #tags of a chirp body in the order they first
+// appear, each one normalized with NormalizeHashtag.
+func Hashtags(body string) []string {
+	tags := []string{}
+	seen := map[string]struct{}{}
+
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRuneInString(body[i:])
+		if r != '#' || (i > 0 && isTagRune(lastRune(body[:i]))) {
+			i += size
+			continue
+		}
+
+		end := i + size
+		for end < len(body) {
+			next, nextSize := utf8.DecodeRuneInString(body[end:])
+			if !isTagRune(next) {
+				break
+			}
+			end += nextSize
+		}
+
+		tag, ok := NormalizeHashtag(body[i:end])
+		if ok {
+			_, dup := seen[tag]
+			if !dup {
+				seen[tag] = struct{}{}
+				tags = append(tags, tag)
+			}
+		}
+		i = end
+	}
+
+	return tags
+}
+
+// NormalizeHashtag case folds a hashtag and brings it to NFKC form, so that
+// "#Café" and "#CAFÉ" are the same tag however they were typed. The leading
+// # is optional. Tags without a single letter, like "#1", are not tags.
+func NormalizeHashtag(tag string) (string, bool) {
+	tag = strings.TrimPrefix(tag, "#")
+	tag = norm.NFKC.String(cases.Fold().String(tag))
+
+	hasLetter := false
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return "", false
+		}
+		if unicode.IsLetter(r) {
+			hasLetter = true
+		}
+	}
+	if !hasLetter || utf8.RuneCountInString(tag) > hashtagLenMax {
+		return "", false
+	}
+	return tag, true
+}
+
+func isTagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+const usernameLenMax = 15
+
+// Mention is an @username in a chirp body. Start and End are offsets in
+// Unicode code points, End is exclusive and both include the @.
+type Mention struct {
+	Username string
+	Start    int
+	End      int
+}
+
+// Mentions returns every @username of a chirp body in the order they appear.
+// Like with hashtags an @ right after a word, as in an email address, is not a
+// mention.
+func Mentions(body string) []Mention {
+	mentions := []Mention{}
+
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && isTagRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isUsernameRune(runes[end]) {
+			end++
+		}
+		// a mention can't run into a word, "@john_pörk" is not "@john_p"
+		if end < len(runes) && isTagRune(runes[end]) {
+			i = end
+			continue
+		}
+
+		username := string(runes[i+1 : end])
+		if ValidUsername(username) {
+			mentions = append(mentions, Mention{Username: username, Start: i, End: end})
+		}
+		i = end - 1
+	}
+
+	return mentions
+}
+
+// ValidUsername reports whether s can be a username: 1 to 15 ASCII letters,
+// digits or underscores.
+func ValidUsername(s string) bool {
+	if s == "" || len(s) > usernameLenMax {
+		return false
+	}
+	for _, r := range s {
+		if !isUsernameRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isUsernameRune(r rune) bool {
+	return r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
@@ -0,0 +1,229 @@
+package chirptext
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHashtags(t *testing.T) {
+	cases := map[string]struct {
+		body string
+		want []string
+	}{
+		"no tags": {
+			body: "hello I am John Pork",
+			want: []string{},
+		},
+		"single tag": {
+			body: "calling you #pork",
+			want: []string{"pork"},
+		},
+		"tags are case folded": {
+			body: "#Pork #PORK #pork",
+			want: []string{"pork"},
+		},
+		"punctuation ends a tag": {
+			body: "#pork, #beef! (#ham)",
+			want: []string{"pork", "beef", "ham"},
+		},
+		"unicode letters": {
+			body: "#żółw #Straße #日本語",
+			want: []string{"żółw", "strasse", "日本語"},
+		},
+		"composed and decomposed forms are one tag": {
+			body: "#caf\u00e9 #cafe\u0301",
+			want: []string{"café"},
+		},
+		"digits alone are not a tag": {
+			body: "number #1 #2fast",
+			want: []string{"2fast"},
+		},
+		"hash inside a word is not a tag": {
+			body: "C#sharp issue#42",
+			want: []string{},
+		},
+		"underscores": {
+			body: "#john_pork",
+			want: []string{"john_pork"},
+		},
+		"lone hash": {
+			body: "# #",
+			want: []string{},
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got := Hashtags(c.body)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Hashtags() got = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	cases := map[string]struct {
+		tag    string
+		want   string
+		wantOK bool
+	}{
+		"with hash": {
+			tag:    "#Pork",
+			want:   "pork",
+			wantOK: true,
+		},
+		"without hash": {
+			tag:    "Pork",
+			want:   "pork",
+			wantOK: true,
+		},
+		"spaces are not allowed": {
+			tag:    "john pork",
+			wantOK: false,
+		},
+		"empty": {
+			tag:    "#",
+			wantOK: false,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got, ok := NormalizeHashtag(c.tag)
+			if ok != c.wantOK {
+				t.Errorf("NormalizeHashtag() ok = %v, want %v", ok, c.wantOK)
+				return
+			}
+			if got != c.want {
+				t.Errorf("NormalizeHashtag() got = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	cases := map[string]struct {
+		body string
+		want []Mention
+	}{
+		"no mentions": {
+			body: "hello I am John Pork",
+			want: []Mention{},
+		},
+		"single mention": {
+			body: "calling @john_pork",
+			want: []Mention{{Username: "john_pork", Start: 8, End: 18}},
+		},
+		"offsets count code points": {
+			body: "żółw @pork",
+			want: []Mention{{Username: "pork", Start: 5, End: 10}},
+		},
+		"punctuation ends a mention": {
+			body: "(@pork), @beef!",
+			want: []Mention{
+				{Username: "pork", Start: 1, End: 6},
+				{Username: "beef", Start: 9, End: 14},
+			},
+		},
+		"repeated mentions are all kept": {
+			body: "@pork @pork",
+			want: []Mention{
+				{Username: "pork", Start: 0, End: 5},
+				{Username: "pork", Start: 6, End: 11},
+			},
+		},
+		"email is not a mention": {
+			body: "john.pork@example.com",
+			want: []Mention{},
+		},
+		"non-ascii letters are not part of usernames": {
+			body: "@pörk",
+			want: []Mention{},
+		},
+		"too long": {
+			body: "@john_pork_calling",
+			want: []Mention{},
+		},
+		"lone at": {
+			body: "@ @",
+			want: []Mention{},
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got := Mentions(c.body)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Mentions() got = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLength(t *testing.T) {
+	cases := map[string]struct {
+		body string
+		want int
+	}{
+		"empty": {
+			body: "",
+			want: 0,
+		},
+		"ascii": {
+			body: "hello I am John Pork",
+			want: 20,
+		},
+		"multibyte letters": {
+			body: "żółw",
+			want: 4,
+		},
+		"decomposed letters": {
+			body: "cafe\u0301",
+			want: 4,
+		},
+		"emoji": {
+			body: strings.Repeat("\U0001F437", 50),
+			want: 50,
+		},
+		"emoji with skin tone": {
+			body: "\U0001F44D\U0001F3FD",
+			want: 1,
+		},
+		"family emoji": {
+			body: "\U0001F468\u200D\U0001F469\u200D\U0001F467",
+			want: 1,
+		},
+		"url": {
+			body: "https://example.com/" + strings.Repeat("a", 100),
+			want: URLLength,
+		},
+		"short url": {
+			body: "see http://x.io",
+			want: 4 + URLLength,
+		},
+		"trailing punctuation is not part of the url": {
+			body: "(https://example.com).",
+			want: 1 + URLLength + 2,
+		},
+		"several urls": {
+			body: "https://a.com and HTTPS://b.com",
+			want: URLLength + 5 + URLLength,
+		},
+		"scheme alone is not a url": {
+			body: "https://",
+			want: 8,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got := Length(c.body)
+			if got != c.want {
+				t.Errorf("Length() got = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
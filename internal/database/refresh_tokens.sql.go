@@ -7,68 +7,190 @@ package database
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createToken = `-- name: CreateToken :one
 INSERT INTO refresh_tokens (
-	token,
+	token_hash,
+	family_id,
+	family_created_at,
 	created_at,
 	updated_at,
+	last_used_at,
 	user_id,
 	expires_at,
-	revoked_at
+	user_agent,
+	ip,
+	client_id,
+	scopes
 ) VALUES (
 	$1,
-	now(),
-	now(),
 	$2,
 	$3,
-	$4
-) RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+	now(),
+	now(),
+	now(),
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	$9
+) RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, family_created_at, last_used_at, user_agent, ip, client_id, scopes
 `
 
 type CreateTokenParams struct {
-	Token     string
-	UserID    uuid.UUID
-	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	TokenHash       string
+	FamilyID        uuid.UUID
+	FamilyCreatedAt time.Time
+	UserID          uuid.UUID
+	ExpiresAt       time.Time
+	UserAgent       string
+	Ip              string
+	ClientID        uuid.NullUUID
+	Scopes          []string
 }
 
 func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (RefreshToken, error) {
 	row := q.db.QueryRowContext(ctx, createToken,
-		arg.Token,
+		arg.TokenHash,
+		arg.FamilyID,
+		arg.FamilyCreatedAt,
 		arg.UserID,
 		arg.ExpiresAt,
-		arg.RevokedAt,
+		arg.UserAgent,
+		arg.Ip,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
 	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.FamilyCreatedAt,
+		&i.LastUsedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
 
-const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT user_id FROM refresh_tokens
-WHERE token = $1
-AND expires_at > now()
-AND (revoked_at > now() OR revoked_at is null)
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, family_created_at, last_used_at, user_agent, ip, client_id, scopes FROM refresh_tokens
+WHERE token_hash = $1
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
-	var user_id uuid.UUID
-	err := row.Scan(&user_id)
-	return user_id, err
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.FamilyCreatedAt,
+		&i.LastUsedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, family_created_at, last_used_at, user_agent, ip, client_id, scopes FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenForUpdate, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.FamilyCreatedAt,
+		&i.LastUsedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const getUserSessions = `-- name: GetUserSessions :many
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, family_created_at, last_used_at, user_agent, ip, client_id, scopes FROM refresh_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND expires_at > $2::timestamp
+ORDER BY last_used_at DESC, family_id
+`
+
+type GetUserSessionsParams struct {
+	UserID uuid.UUID
+	Now    time.Time
+}
+
+func (q *Queries) GetUserSessions(ctx context.Context, arg GetUserSessionsParams) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, getUserSessions, arg.UserID, arg.Now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.TokenHash,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.FamilyID,
+			&i.RotatedAt,
+			&i.FamilyCreatedAt,
+			&i.LastUsedAt,
+			&i.UserAgent,
+			&i.Ip,
+			&i.ClientID,
+			pq.Array(&i.Scopes),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
@@ -76,10 +198,112 @@ UPDATE refresh_tokens
 SET
 	updated_at = now(),
 	revoked_at = now()
-WHERE token = $1
+WHERE token_hash = $1
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, tokenHash)
+	return err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	revoked_at = now()
+WHERE family_id = $1
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	revoked_at = now()
+WHERE user_id = $1
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRefreshTokens, userID)
+	return err
+}
+
+const revokeUserRefreshTokensExcept = `-- name: RevokeUserRefreshTokensExcept :exec
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	revoked_at = now()
+WHERE user_id = $1
+AND family_id <> $2
+AND revoked_at IS NULL
+`
+
+type RevokeUserRefreshTokensExceptParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeUserRefreshTokensExcept(ctx context.Context, arg RevokeUserRefreshTokensExceptParams) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRefreshTokensExcept, arg.UserID, arg.FamilyID)
+	return err
+}
+
+const revokeUserSession = `-- name: RevokeUserSession :many
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	revoked_at = now()
+WHERE user_id = $1
+AND family_id = $2
+AND revoked_at IS NULL
+RETURNING family_id
+`
+
+type RevokeUserSessionParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeUserSession(ctx context.Context, arg RevokeUserSessionParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, revokeUserSession, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var family_id uuid.UUID
+		if err := rows.Scan(&family_id); err != nil {
+			return nil, err
+		}
+		items = append(items, family_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :exec
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	rotated_at = now(),
+	revoked_at = now()
+WHERE token_hash = $1
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RotateRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, rotateRefreshToken, tokenHash)
 	return err
 }
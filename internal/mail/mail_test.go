@@ -0,0 +1,110 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2025, 5, 6, 14, 36, 24, 0, time.UTC)
+
+	cases := map[string]struct {
+		msg     Message
+		want    string
+		wantErr bool
+	}{
+		"plain": {
+			msg: Message{To: "john.pork@example.com", Subject: "Hello", Body: "calling you\nsoon"},
+			want: "From: chirpy@example.com\r\n" +
+				"To: john.pork@example.com\r\n" +
+				"Subject: Hello\r\n" +
+				"Date: Tue, 06 May 2025 14:36:24 +0000\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: 8bit\r\n" +
+				"\r\n" +
+				"calling you\r\nsoon",
+		},
+		"non-ascii subject is encoded": {
+			msg: Message{To: "john.pork@example.com", Subject: "Żółw", Body: ""},
+			want: "From: chirpy@example.com\r\n" +
+				"To: john.pork@example.com\r\n" +
+				"Subject: =?utf-8?q?=C5=BB=C3=B3=C5=82w?=\r\n" +
+				"Date: Tue, 06 May 2025 14:36:24 +0000\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: 8bit\r\n" +
+				"\r\n",
+		},
+		"header injection": {
+			msg:     Message{To: "john.pork@example.com\r\nBcc: everyone@example.com", Subject: "Hello"},
+			wantErr: true,
+		},
+		"subject injection": {
+			msg:     Message{To: "john.pork@example.com", Subject: "Hello\nBcc: everyone@example.com"},
+			wantErr: true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got, err := Format("chirpy@example.com", c.msg, date)
+			if (err != nil) != c.wantErr {
+				t.Errorf("Format() error = %v, wantErr %v", err, c.wantErr)
+				return
+			}
+			if string(got) != c.want {
+				t.Errorf("Format() got = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := &MemoryMailer{}
+	msgs := []Message{
+		{To: "john.pork@example.com", Subject: "one"},
+		{To: "john.pork@example.com", Subject: "two"},
+	}
+	for _, msg := range msgs {
+		err := mailer.Send(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	got := mailer.Messages()
+	if !reflect.DeepEqual(got, msgs) {
+		t.Errorf("Messages() got = %v, want %v", got, msgs)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := NewFileMailer(dir, "chirpy@example.com")
+	if err != nil {
+		t.Fatalf("NewFileMailer() error = %v", err)
+	}
+
+	err = mailer.Send(context.Background(), Message{To: "john.pork@example.com", Subject: "Hello", Body: "calling you"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir() got %v entries, error = %v, want 1", len(entries), err)
+	}
+	dat, err := os.ReadFile(dir + "/" + entries[0].Name())
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !strings.Contains(string(dat), "To: john.pork@example.com\r\n") || !strings.HasSuffix(string(dat), "\r\ncalling you") {
+		t.Errorf("FileMailer wrote %q", dat)
+	}
+}
@@ -0,0 +1,83 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	ctx := context.Background()
+
+	err = store.Put(ctx, "pork.png", strings.NewReader("oink"))
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	blob, err := store.Open(ctx, "pork.png")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	dat, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil || string(dat) != "oink" {
+		t.Errorf("Open() got = %q, %v, want %q", dat, err, "oink")
+	}
+
+	err = store.Delete(ctx, "pork.png")
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	_, err = store.Open(ctx, "pork.png")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+	err = store.Delete(ctx, "pork.png")
+	if err != nil {
+		t.Errorf("Delete() of a missing blob error = %v", err)
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	cases := map[string]struct {
+		key  string
+		want bool
+	}{
+		"file name": {
+			key:  "9b1deb4d-3b7d-4bad-9bdd-2b0d7b3dcb6d_thumb.jpg",
+			want: true,
+		},
+		"empty": {
+			key:  "",
+			want: false,
+		},
+		"parent directory": {
+			key:  "..",
+			want: false,
+		},
+		"path": {
+			key:  "../etc/passwd",
+			want: false,
+		},
+		"hidden file": {
+			key:  ".upload-123",
+			want: false,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got := ValidKey(c.key)
+			if got != c.want {
+				t.Errorf("ValidKey() got = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
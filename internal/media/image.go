@@ -0,0 +1,222 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxBytes is the largest upload accepted.
+	MaxBytes = 5 << 20
+	// MaxDimension is the largest width or height accepted.
+	MaxDimension = 4096
+	// ThumbnailSize is the largest width or height of a thumbnail.
+	ThumbnailSize = 320
+
+	jpegQuality = 90
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type, expected a JPEG, PNG, GIF or WebP image")
+	ErrTooLarge        = fmt.Errorf("image is too large, the limit is %d bytes and %dx%d pixels", MaxBytes, MaxDimension, MaxDimension)
+)
+
+// Image is an upload re-encoded from its pixels alone, which leaves EXIF and
+// any other metadata behind. JPEGs stay JPEGs, everything else becomes PNG.
+type Image struct {
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+	Data        []byte
+	Thumbnail   []byte
+}
+
+// Process validates an uploaded image and re-encodes it along with a
+// thumbnail. JPEGs are turned upright according to their EXIF orientation
+// first, since the orientation doesn't survive the re-encoding.
+func Process(data []byte) (Image, error) {
+	if len(data) > MaxBytes {
+		return Image{}, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return Image{}, ErrUnsupportedType
+	}
+
+	// checked before decoding, so a small file can't claim a huge image
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupportedType
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return Image{}, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupportedType
+	}
+
+	encode := encodePNG
+	processed := Image{ContentType: "image/png", Ext: ".png"}
+	if contentType == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+		encode = encodeJPEG
+		processed = Image{ContentType: "image/jpeg", Ext: ".jpg"}
+	}
+
+	processed.Width = img.Bounds().Dx()
+	processed.Height = img.Bounds().Dy()
+	processed.Data, err = encode(img)
+	if err != nil {
+		return Image{}, err
+	}
+	processed.Thumbnail, err = encode(thumbnail(img))
+	if err != nil {
+		return Image{}, err
+	}
+	return processed, nil
+}
+
+func encodeJPEG(img image.Image) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	return buf.Bytes(), err
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// thumbnail scales img down to fit ThumbnailSize, keeping its aspect ratio.
+func thumbnail(img image.Image) image.Image {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width <= ThumbnailSize && height <= ThumbnailSize {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*ThumbnailSize/width)
+		width = ThumbnailSize
+	} else {
+		width = max(1, width*ThumbnailSize/height)
+		height = ThumbnailSize
+	}
+
+	thumb := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(thumb, thumb.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return thumb
+}
+
+// orient turns an image upright according to an EXIF orientation, 1 to 8.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	// source pixel of every destination pixel
+	source := map[int]func(x, y int) (int, int){
+		2: func(x, y int) (int, int) { return w - 1 - x, y },
+		3: func(x, y int) (int, int) { return w - 1 - x, h - 1 - y },
+		4: func(x, y int) (int, int) { return x, h - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return y, h - 1 - x },
+		7: func(x, y int) (int, int) { return w - 1 - y, h - 1 - x },
+		8: func(x, y int) (int, int) { return w - 1 - y, x },
+	}[orientation]
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := range dstH {
+		for x := range dstW {
+			sx, sy := source(x, y)
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// exifOrientation reads the orientation tag of a JPEG, 1 when there is none.
+func exifOrientation(data []byte) int {
+	const (
+		markerSOI  = 0xd8
+		markerAPP1 = 0xe1
+		markerSOS  = 0xda
+
+		tagOrientation = 0x0112
+	)
+
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == markerSOS || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		i += 2 + length
+
+		if marker != markerAPP1 || !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			continue
+		}
+		tiff := segment[6:]
+		if len(tiff) < 8 {
+			return 1
+		}
+
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return 1
+		}
+
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return 1
+		}
+		entries := int(order.Uint16(tiff[ifd:]))
+		for e := range entries {
+			entry := ifd + 2 + e*12
+			if entry+12 > len(tiff) {
+				return 1
+			}
+			if order.Uint16(tiff[entry:]) == tagOrientation {
+				return int(order.Uint16(tiff[entry+8:]))
+			}
+		}
+		return 1
+	}
+	return 1
+}
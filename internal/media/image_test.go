@@ -0,0 +1,179 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(width, height int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	// a white top left corner to follow through rotations
+	img.Set(0, 0, color.White)
+	return img
+}
+
+func testPNG(width, height int) []byte {
+	buf := bytes.Buffer{}
+	_ = png.Encode(&buf, testImage(width, height))
+	return buf.Bytes()
+}
+
+// testJPEG encodes a JPEG carrying an EXIF segment with the orientation.
+func testJPEG(width, height, orientation int) []byte {
+	buf := bytes.Buffer{}
+	_ = jpeg.Encode(&buf, testImage(width, height), nil)
+	data := buf.Bytes()
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1) // one IFD entry
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	return append(append(data[:2:2], app1...), data[2:]...)
+}
+
+func TestProcess(t *testing.T) {
+	cases := map[string]struct {
+		data            []byte
+		wantContentType string
+		wantWidth       int
+		wantHeight      int
+		wantThumbWidth  int
+		wantThumbHeight int
+		wantErr         error
+	}{
+		"png": {
+			data:            testPNG(640, 480),
+			wantContentType: "image/png",
+			wantWidth:       640,
+			wantHeight:      480,
+			wantThumbWidth:  320,
+			wantThumbHeight: 240,
+		},
+		"small images are their own thumbnail": {
+			data:            testPNG(100, 50),
+			wantContentType: "image/png",
+			wantWidth:       100,
+			wantHeight:      50,
+			wantThumbWidth:  100,
+			wantThumbHeight: 50,
+		},
+		"jpeg": {
+			data:            testJPEG(400, 800, 1),
+			wantContentType: "image/jpeg",
+			wantWidth:       400,
+			wantHeight:      800,
+			wantThumbWidth:  160,
+			wantThumbHeight: 320,
+		},
+		"jpeg rotated by exif": {
+			data:            testJPEG(400, 200, 6),
+			wantContentType: "image/jpeg",
+			wantWidth:       200,
+			wantHeight:      400,
+			wantThumbWidth:  160,
+			wantThumbHeight: 320,
+		},
+		"not an image": {
+			data:    []byte("hello I am John Pork"),
+			wantErr: ErrUnsupportedType,
+		},
+		"truncated image": {
+			data:    testPNG(64, 64)[:100],
+			wantErr: ErrUnsupportedType,
+		},
+		"too many pixels": {
+			data:    testPNG(MaxDimension+1, 1),
+			wantErr: ErrTooLarge,
+		},
+		"too many bytes": {
+			data:    append(testPNG(1, 1), make([]byte, MaxBytes)...),
+			wantErr: ErrTooLarge,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got, err := Process(c.data)
+			if !errors.Is(err, c.wantErr) {
+				t.Errorf("Process() error = %v, wantErr %v", err, c.wantErr)
+				return
+			}
+			if c.wantErr != nil {
+				return
+			}
+
+			if got.ContentType != c.wantContentType {
+				t.Errorf("Process() content type = %v, want %v", got.ContentType, c.wantContentType)
+			}
+			if got.Width != c.wantWidth || got.Height != c.wantHeight {
+				t.Errorf("Process() size = %vx%v, want %vx%v", got.Width, got.Height, c.wantWidth, c.wantHeight)
+			}
+			if bytes.Contains(got.Data, []byte("Exif")) {
+				t.Errorf("Process() kept the EXIF metadata")
+			}
+
+			thumb, _, err := image.DecodeConfig(bytes.NewReader(got.Thumbnail))
+			if err != nil {
+				t.Errorf("Process() thumbnail error = %v", err)
+				return
+			}
+			if thumb.Width != c.wantThumbWidth || thumb.Height != c.wantThumbHeight {
+				t.Errorf("Process() thumbnail size = %vx%v, want %vx%v", thumb.Width, thumb.Height, c.wantThumbWidth, c.wantThumbHeight)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// where the top left corner of a 4x2 image ends up
+	cases := map[int]struct {
+		wantWidth  int
+		wantHeight int
+		wantX      int
+		wantY      int
+	}{
+		1: {wantWidth: 4, wantHeight: 2, wantX: 0, wantY: 0},
+		2: {wantWidth: 4, wantHeight: 2, wantX: 3, wantY: 0},
+		3: {wantWidth: 4, wantHeight: 2, wantX: 3, wantY: 1},
+		4: {wantWidth: 4, wantHeight: 2, wantX: 0, wantY: 1},
+		5: {wantWidth: 2, wantHeight: 4, wantX: 0, wantY: 0},
+		6: {wantWidth: 2, wantHeight: 4, wantX: 1, wantY: 0},
+		7: {wantWidth: 2, wantHeight: 4, wantX: 1, wantY: 3},
+		8: {wantWidth: 2, wantHeight: 4, wantX: 0, wantY: 3},
+	}
+
+	for orientation, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", orientation), func(t *testing.T) {
+			got := orient(testImage(4, 2), orientation)
+			if got.Bounds().Dx() != c.wantWidth || got.Bounds().Dy() != c.wantHeight {
+				t.Errorf("orient() size = %vx%v, want %vx%v", got.Bounds().Dx(), got.Bounds().Dy(), c.wantWidth, c.wantHeight)
+				return
+			}
+			r, g, b, _ := got.At(c.wantX, c.wantY).RGBA()
+			if r != 0xffff || g != 0xffff || b != 0xffff {
+				t.Errorf("orient() corner is not at %v,%v", c.wantX, c.wantY)
+			}
+		})
+	}
+}
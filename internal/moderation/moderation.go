@@ -0,0 +1,238 @@
+package moderation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Action is what happens to a chirp containing a term.
+type Action string
+
+const (
+	// ActionMask replaces the term with asterisks.
+	ActionMask Action = "mask"
+	// ActionReject refuses the chirp altogether.
+	ActionReject Action = "reject"
+	// ActionFlag lets the chirp through but marks it for review.
+	ActionFlag Action = "flag"
+)
+
+const mask = "****"
+
+// ParseAction returns the Action named s.
+func ParseAction(s string) (Action, error) {
+	action := Action(s)
+	switch action {
+	case ActionMask, ActionReject, ActionFlag:
+		return action, nil
+	}
+	return "", fmt.Errorf("unknown action %q, expected mask, reject or flag", s)
+}
+
+// Result is the outcome of checking a chirp body. Rejected and Flagged hold
+// the normalized terms that caused them, each one once.
+type Result struct {
+	Body     string
+	Rejected []string
+	Flagged  []string
+}
+
+// ContentFilter checks chirp bodies for unwanted content.
+type ContentFilter interface {
+	Check(body string) Result
+}
+
+// Term is a word of a WordList with its Action.
+type Term struct {
+	Term   string
+	Action Action
+}
+
+// WordList is a ContentFilter matching whole words. Words are compared after
+// Normalize, so "Fornax!", "FORNAX" and "fórnax" all match the term "fornax".
+// It is safe for concurrent use.
+type WordList struct {
+	mu    sync.RWMutex
+	terms map[string]Action
+}
+
+// NewWordList returns an empty WordList.
+func NewWordList() *WordList {
+	return &WordList{terms: map[string]Action{}}
+}
+
+// Load adds the terms read from r. Every line holds a term optionally
+// followed by its action, mask by default. Blank lines and lines starting
+// with # are skipped.
+func (wl *WordList) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return fmt.Errorf("line %d: expected a term and an optional action", line)
+		}
+
+		action := ActionMask
+		if len(fields) == 2 {
+			var err error
+			action, err = ParseAction(fields[1])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		_, err := wl.Set(fields[0], action)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Set adds a term or changes its action, returning the term normalized.
+func (wl *WordList) Set(term string, action Action) (string, error) {
+	term, err := NormalizeTerm(term)
+	if err != nil {
+		return "", err
+	}
+	_, err = ParseAction(string(action))
+	if err != nil {
+		return "", err
+	}
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	wl.terms[term] = action
+	return term, nil
+}
+
+// Lookup returns the action of a term, reporting whether it's on the list.
+func (wl *WordList) Lookup(term string) (Action, bool) {
+	term = Normalize(term)
+
+	wl.mu.RLock()
+	defer wl.mu.RUnlock()
+	action, ok := wl.terms[term]
+	return action, ok
+}
+
+// Remove removes a term, reporting whether it was on the list.
+func (wl *WordList) Remove(term string) bool {
+	term = Normalize(term)
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	_, ok := wl.terms[term]
+	delete(wl.terms, term)
+	return ok
+}
+
+// Terms returns every term sorted alphabetically.
+func (wl *WordList) Terms() []Term {
+	wl.mu.RLock()
+	defer wl.mu.RUnlock()
+
+	terms := make([]Term, 0, len(wl.terms))
+	for term, action := range wl.terms {
+		terms = append(terms, Term{Term: term, Action: action})
+	}
+	slices.SortFunc(terms, func(a, b Term) int {
+		return strings.Compare(a.Term, b.Term)
+	})
+	return terms
+}
+
+// Check masks the terms of body with asterisks and reports the terms that
+// reject or flag it.
+func (wl *WordList) Check(body string) Result {
+	wl.mu.RLock()
+	defer wl.mu.RUnlock()
+
+	result := Result{}
+	var clean strings.Builder
+
+	start := -1
+	flush := func(end int) {
+		word := body[start:end]
+		start = -1
+
+		term := Normalize(word)
+		switch wl.terms[term] {
+		case ActionMask:
+			clean.WriteString(mask)
+			return
+		case ActionReject:
+			if !slices.Contains(result.Rejected, term) {
+				result.Rejected = append(result.Rejected, term)
+			}
+		case ActionFlag:
+			if !slices.Contains(result.Flagged, term) {
+				result.Flagged = append(result.Flagged, term)
+			}
+		}
+		clean.WriteString(word)
+	}
+
+	for i, r := range body {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			flush(i)
+		}
+		clean.WriteRune(r)
+	}
+	if start >= 0 {
+		flush(len(body))
+	}
+
+	result.Body = clean.String()
+	return result
+}
+
+// Normalize case folds s and strips it of diacritics and compatibility
+// variants, "Fórnax" and "ｆｏｒｎａｘ" both become "fornax".
+func Normalize(s string) string {
+	s = norm.NFKD.String(cases.Fold().String(s))
+	s = strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, s)
+	return norm.NFC.String(s)
+}
+
+// NormalizeTerm normalizes a term for a WordList, which only matches single
+// words.
+func NormalizeTerm(term string) (string, error) {
+	term = Normalize(strings.TrimSpace(term))
+	if term == "" {
+		return "", errors.New("term is empty")
+	}
+	for _, r := range term {
+		if !isWordRune(r) {
+			return "", fmt.Errorf("term %q is not a single word", term)
+		}
+	}
+	return term, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
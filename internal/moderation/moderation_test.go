@@ -0,0 +1,164 @@
+package moderation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	wordList := NewWordList()
+	for term, action := range map[string]Action{
+		"kerfuffle": ActionMask,
+		"sharbert":  ActionMask,
+		"fornax":    ActionMask,
+		"pork":      ActionReject,
+		"beef":      ActionFlag,
+	} {
+		_, err := wordList.Set(term, action)
+		if err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	cases := map[string]struct {
+		body string
+		want Result
+	}{
+		"clean": {
+			body: "hello I am John",
+			want: Result{Body: "hello I am John"},
+		},
+		"mask": {
+			body: "what a kerfuffle",
+			want: Result{Body: "what a ****"},
+		},
+		"case is ignored": {
+			body: "KerFuffle Sharbert",
+			want: Result{Body: "**** ****"},
+		},
+		"punctuation is kept": {
+			body: "Fornax! (sharbert), kerfuffle\nok",
+			want: Result{Body: "****! (****), ****\nok"},
+		},
+		"diacritics are ignored": {
+			body: "f\u00f3rnax",
+			want: Result{Body: "****"},
+		},
+		"decomposed diacritics are ignored": {
+			body: "fo\u0301rnax",
+			want: Result{Body: "****"},
+		},
+		"fullwidth letters are ignored": {
+			body: "ｆｏｒｎａｘ",
+			want: Result{Body: "****"},
+		},
+		"part of a word is not a match": {
+			body: "fornaxes sharberts",
+			want: Result{Body: "fornaxes sharberts"},
+		},
+		"apostrophe ends a word": {
+			body: "sharbert's",
+			want: Result{Body: "****'s"},
+		},
+		"reject": {
+			body: "John Pork is calling, pork!",
+			want: Result{Body: "John Pork is calling, pork!", Rejected: []string{"pork"}},
+		},
+		"flag": {
+			body: "beef and fornax",
+			want: Result{Body: "beef and ****", Flagged: []string{"beef"}},
+		},
+		"empty": {
+			body: "",
+			want: Result{},
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got := wordList.Check(c.body)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Check() got = %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cases := map[string]struct {
+		file    string
+		want    []Term
+		wantErr bool
+	}{
+		"default action": {
+			file: "fornax\n",
+			want: []Term{{Term: "fornax", Action: ActionMask}},
+		},
+		"comments, blank lines and actions": {
+			file: "# banned\n\nPork reject\n  beef   flag\n",
+			want: []Term{
+				{Term: "beef", Action: ActionFlag},
+				{Term: "pork", Action: ActionReject},
+			},
+		},
+		"unknown action": {
+			file:    "pork ban\n",
+			wantErr: true,
+		},
+		"too many fields": {
+			file:    "john pork reject\n",
+			wantErr: true,
+		},
+		"not a word": {
+			file:    "f-word\n",
+			wantErr: true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			wordList := NewWordList()
+			err := wordList.Load(strings.NewReader(c.file))
+			if (err != nil) != c.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, c.wantErr)
+				return
+			}
+			if c.wantErr {
+				return
+			}
+			got := wordList.Terms()
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Terms() got = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	wordList := NewWordList()
+	_, err := wordList.Set("fornax", ActionMask)
+	if err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	action, ok := wordList.Lookup("FORNAX")
+	if !ok || action != ActionMask {
+		t.Errorf("Lookup() = %q, %v, want %q, true", action, ok, ActionMask)
+	}
+	if !wordList.Remove("FORNAX") {
+		t.Errorf("Remove() = false, want true")
+	}
+	if wordList.Remove("fornax") {
+		t.Errorf("Remove() of a removed term = true, want false")
+	}
+	_, ok = wordList.Lookup("fornax")
+	if ok {
+		t.Errorf("Lookup() of a removed term = true, want false")
+	}
+	got := wordList.Check("fornax")
+	if got.Body != "fornax" {
+		t.Errorf("Check() after Remove() got = %q, want %q", got.Body, "fornax")
+	}
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// TSQuery turns a user's search into PostgreSQL to_tsquery syntax. Words are
+// all required, "quoted words" have to appear next to each other and a word
+// ending with * matches every word it's a prefix of.
+//
+// Anything that isn't a letter or a digit is dropped, so the result is always
+// safe to hand to to_tsquery.
+func TSQuery(query string) (string, error) {
+	terms := []string{}
+
+	for i, part := range strings.Split(query, `"`) {
+		phrase := i%2 == 1 // odd parts are between quotes
+		if phrase {
+			lexemes := lexemes(part)
+			if len(lexemes) == 0 {
+				continue
+			}
+			terms = append(terms, "("+strings.Join(quoteAll(lexemes), " <-> ")+")")
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			prefix := strings.HasSuffix(word, "*")
+			lexemes := quoteAll(lexemes(word))
+			if len(lexemes) == 0 {
+				continue
+			}
+			if prefix {
+				lexemes[len(lexemes)-1] += ":*"
+			}
+			if len(lexemes) == 1 {
+				terms = append(terms, lexemes[0])
+				continue
+			}
+			// words like "e-mail" are searched for as a phrase
+			terms = append(terms, "("+strings.Join(lexemes, " <-> ")+")")
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", errors.New("search query has no words to search for")
+	}
+	return strings.Join(terms, " & "), nil
+}
+
+func lexemes(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func quoteAll(lexemes []string) []string {
+	quoted := make([]string, 0, len(lexemes))
+	for _, lexeme := range lexemes {
+		quoted = append(quoted, "'"+lexeme+"'")
+	}
+	return quoted
+}
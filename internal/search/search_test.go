@@ -0,0 +1,72 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTSQuery(t *testing.T) {
+	cases := map[string]struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		"single word": {
+			query: "pork",
+			want:  "'pork'",
+		},
+		"words are all required": {
+			query: "john  pork",
+			want:  "'john' & 'pork'",
+		},
+		"phrase": {
+			query: `"john pork" calling`,
+			want:  "('john' <-> 'pork') & 'calling'",
+		},
+		"prefix": {
+			query: "califor*",
+			want:  "'califor':*",
+		},
+		"case is folded": {
+			query: "PoRK",
+			want:  "'pork'",
+		},
+		"unicode words": {
+			query: "żółw café",
+			want:  "'żółw' & 'café'",
+		},
+		"punctuation inside a word makes a phrase": {
+			query: "e-mail",
+			want:  "('e' <-> 'mail')",
+		},
+		"tsquery operators are dropped": {
+			query: "pork & !beef | (ham) <-> 'x':*",
+			want:  "'pork' & 'beef' & 'ham' & 'x':*",
+		},
+		"unterminated quote is still a phrase": {
+			query: `"john pork`,
+			want:  "('john' <-> 'pork')",
+		},
+		"empty": {
+			query:   "",
+			wantErr: true,
+		},
+		"nothing searchable": {
+			query:   `!! "" * &`,
+			wantErr: true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got, err := TSQuery(c.query)
+			if (err != nil) != c.wantErr {
+				t.Errorf("TSQuery() error = %v, wantErr %v", err, c.wantErr)
+				return
+			}
+			if got != c.want {
+				t.Errorf("TSQuery() got = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Package throttle slows down repeated failures, like password guesses, with
+// exponential backoff and temporary lockouts.
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Record is what a Store remembers about the failures of a key.
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+	// Notified is whether the lockout of the failures was reported.
+	Notified bool
+}
+
+// Store counts failures per key.
+type Store interface {
+	// Fail records a failure of the key at the time given and returns the
+	// updated record. A record whose last failure was before since starts
+	// over, forgetting older failures.
+	Fail(ctx context.Context, key string, at, since time.Time) (Record, error)
+	// Forgive takes back one failure of the key, counted for an attempt
+	// that didn't fail after all.
+	Forgive(ctx context.Context, key string) error
+	// Notify marks the record of the key Notified, returning whether it
+	// wasn't yet. A record starting over isn't Notified anymore.
+	Notify(ctx context.Context, key string) (bool, error)
+	// Get returns the record of the key, a zero Record if there's none.
+	Get(ctx context.Context, key string) (Record, error)
+	// Reset forgets the failures of the key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy says how long to wait after failures.
+type Policy struct {
+	// Free is how many failures go without any wait.
+	Free int
+	// BaseDelay is the wait after the first failure past Free, doubling
+	// with every failure after it up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures, every failure waits Lockout instead.
+	LockoutAfter int
+	Lockout      time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// Delay returns how long to wait after the record's last failure.
+func (p Policy) Delay(failures int) time.Duration {
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return p.Lockout
+	}
+	if failures <= p.Free {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for range failures - p.Free - 1 {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Locked reports whether the failures lock the key out.
+func (p Policy) Locked(failures int) bool {
+	return p.LockoutAfter > 0 && failures >= p.LockoutAfter
+}
+
+// Wait returns how long from now the key of the record has to wait.
+func (p Policy) Wait(record Record, now time.Time) time.Duration {
+	if record.Failures == 0 || now.Sub(record.LastFailure) >= p.Window {
+		return 0
+	}
+	return max(record.LastFailure.Add(p.Delay(record.Failures)).Sub(now), 0)
+}
+
+// Limiter applies a Policy to the failures counted by a Store.
+type Limiter struct {
+	Store  Store
+	Policy Policy
+	// Now is the clock, time.Now if nil.
+	Now func() time.Time
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
+
+// Wait returns how long the key has to wait before trying again.
+func (l *Limiter) Wait(ctx context.Context, key string) (time.Duration, error) {
+	record, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return l.Policy.Wait(record, l.now()), nil
+}
+
+// Fail records a failure of the key, returning its record and how long it
+// has to wait now.
+func (l *Limiter) Fail(ctx context.Context, key string) (Record, time.Duration, error) {
+	now := l.now()
+	record, err := l.Store.Fail(ctx, key, now, now.Add(-l.Policy.Window))
+	if err != nil {
+		return Record{}, 0, err
+	}
+	return record, l.Policy.Wait(record, now), nil
+}
+
+// Attempt counts an attempt of the key as a failure before it's made, so
+// attempts made at the same time can't all go ahead on a record none of them
+// failed yet. It returns how long the key has to wait instead, when it's 0
+// the attempt goes ahead and is then either left failed, Forgiven or Reset.
+// Attempts that have to wait aren't counted.
+func (l *Limiter) Attempt(ctx context.Context, key string) (time.Duration, error) {
+	now := l.now()
+	before, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	wait := l.Policy.Wait(before, now)
+	if wait > 0 {
+		return wait, nil
+	}
+	if now.Sub(before.LastFailure) >= l.Policy.Window {
+		before = Record{}
+	}
+
+	record, err := l.Store.Fail(ctx, key, now, now.Add(-l.Policy.Window))
+	if err != nil {
+		return 0, err
+	}
+	// others attempting since the record was read failed just before
+	if record.Failures == before.Failures+1 {
+		return 0, nil
+	}
+	wait = l.Policy.Delay(record.Failures - 1)
+	if wait > 0 {
+		return wait, l.Store.Forgive(ctx, key)
+	}
+	return 0, nil
+}
+
+// Forgive takes back the failure Attempt counted for an attempt that
+// succeeded, keeping the failures before it.
+func (l *Limiter) Forgive(ctx context.Context, key string) error {
+	return l.Store.Forgive(ctx, key)
+}
+
+// Lockout tells whether the key is locked out and the lockout wasn't
+// reported yet, true only once however many failures step past
+// Policy.LockoutAfter at the same time.
+func (l *Limiter) Lockout(ctx context.Context, key string) (Record, bool, error) {
+	record, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return Record{}, false, err
+	}
+	if !l.Policy.Locked(record.Failures) || record.Notified || l.Policy.Wait(record, l.now()) == 0 {
+		return record, false, nil
+	}
+	first, err := l.Store.Notify(ctx, key)
+	return record, first, err
+}
+
+// Reset forgets the failures of the key.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, key)
+}
+
+// MemoryStore is a Store for a single server, forgetting everything on
+// restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	pruned  time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}}
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, at, since time.Time) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(at, since)
+
+	record := s.records[key]
+	if record.LastFailure.Before(since) {
+		record = Record{}
+	}
+	record.Failures++
+	record.LastFailure = at
+	s.records[key] = record
+	return record, nil
+}
+
+func (s *MemoryStore) Forgive(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if ok && record.Failures > 0 {
+		record.Failures--
+		s.records[key] = record
+	}
+	return nil
+}
+
+func (s *MemoryStore) Notify(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok || record.Notified {
+		return false, nil
+	}
+	record.Notified = true
+	s.records[key] = record
+	return true, nil
+}
+
+// prune drops the records nobody failed since, once every window, so keys
+// that stopped failing don't pile up.
+func (s *MemoryStore) prune(at, since time.Time) {
+	if !s.pruned.Before(since) {
+		return
+	}
+	for key, record := range s.records {
+		if record.LastFailure.Before(since) {
+			delete(s.records, key)
+		}
+	}
+	s.pruned = at
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[key], nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,279 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	Free:         2,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	LockoutAfter: 8,
+	Lockout:      time.Hour,
+	Window:       2 * time.Hour,
+}
+
+func TestPolicyDelay(t *testing.T) {
+	cases := map[string]struct {
+		failures int
+		want     time.Duration
+	}{
+		"no failures": {
+			failures: 0,
+			want:     0,
+		},
+		"free failures": {
+			failures: 2,
+			want:     0,
+		},
+		"first delay": {
+			failures: 3,
+			want:     time.Second,
+		},
+		"doubled": {
+			failures: 5,
+			want:     4 * time.Second,
+		},
+		"capped": {
+			failures: 7,
+			want:     10 * time.Second,
+		},
+		"locked out": {
+			failures: 8,
+			want:     time.Hour,
+		},
+		"still locked out": {
+			failures: 50,
+			want:     time.Hour,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			got := testPolicy.Delay(c.failures)
+			if got != c.want {
+				t.Errorf("Delay() got = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	limiter := Limiter{
+		Store:  NewMemoryStore(),
+		Policy: testPolicy,
+		Now:    func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	wait := func(key string) time.Duration {
+		t.Helper()
+		got, err := limiter.Wait(ctx, key)
+		if err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		return got
+	}
+	fail := func(key string, times int) Record {
+		t.Helper()
+		var record Record
+		for range times {
+			var err error
+			record, _, err = limiter.Fail(ctx, key)
+			if err != nil {
+				t.Fatalf("Fail() error = %v", err)
+			}
+		}
+		return record
+	}
+
+	fail("alice", 3)
+	if got := wait("alice"); got != time.Second {
+		t.Errorf("Wait() after 3 failures got = %v, want 1s", got)
+	}
+	if got := wait("bob"); got != 0 {
+		t.Errorf("Wait() of another key got = %v, want 0", got)
+	}
+
+	now = now.Add(400 * time.Millisecond)
+	if got := wait("alice"); got != 600*time.Millisecond {
+		t.Errorf("Wait() later got = %v, want 600ms", got)
+	}
+
+	record := fail("alice", 5)
+	if !testPolicy.Locked(record.Failures) {
+		t.Errorf("Locked() after %d failures got = false, want true", record.Failures)
+	}
+	if got := wait("alice"); got != time.Hour {
+		t.Errorf("Wait() when locked out got = %v, want 1h", got)
+	}
+
+	now = now.Add(3 * time.Hour)
+	if got := wait("alice"); got != 0 {
+		t.Errorf("Wait() after the window got = %v, want 0", got)
+	}
+	if record := fail("alice", 1); record.Failures != 1 {
+		t.Errorf("Fail() after the window got %d failures, want 1", record.Failures)
+	}
+
+	err := limiter.Reset(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if record, _ := limiter.Store.Get(ctx, "alice"); record.Failures != 0 {
+		t.Errorf("Get() after Reset() got %d failures, want 0", record.Failures)
+	}
+}
+
+// racingStore fails the key for someone else right after the next Get, like
+// an attempt made at the same time reading the same record would.
+type racingStore struct {
+	*MemoryStore
+	at     time.Time
+	racing bool
+}
+
+func (s *racingStore) Get(ctx context.Context, key string) (Record, error) {
+	record, err := s.MemoryStore.Get(ctx, key)
+	if s.racing {
+		s.racing = false
+		_, err = s.MemoryStore.Fail(ctx, key, s.at, s.at.Add(-testPolicy.Window))
+	}
+	return record, err
+}
+
+func TestLimiterAttempt(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &racingStore{MemoryStore: NewMemoryStore(), at: now}
+	limiter := Limiter{
+		Store:  store,
+		Policy: testPolicy,
+		Now:    func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	attempt := func(key string) time.Duration {
+		t.Helper()
+		wait, err := limiter.Attempt(ctx, key)
+		if err != nil {
+			t.Fatalf("Attempt() error = %v", err)
+		}
+		return wait
+	}
+	failures := func(key string) int {
+		t.Helper()
+		record, _ := store.MemoryStore.Get(ctx, key)
+		return record.Failures
+	}
+
+	for i := range testPolicy.Free + 1 {
+		if got := attempt("alice"); got != 0 {
+			t.Fatalf("Attempt() %d got = %v, want 0", i+1, got)
+		}
+	}
+	if got := attempt("alice"); got != time.Second {
+		t.Errorf("Attempt() past the free ones got = %v, want 1s", got)
+	}
+	if got := failures("alice"); got != testPolicy.Free+1 {
+		t.Errorf("Attempt() counted %d failures, want %d without the one that had to wait", got, testPolicy.Free+1)
+	}
+
+	err := limiter.Forgive(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Forgive() error = %v", err)
+	}
+	if got := failures("alice"); got != testPolicy.Free {
+		t.Errorf("Forgive() left %d failures, want %d", got, testPolicy.Free)
+	}
+
+	// someone else got in between reading the record and counting
+	store.racing = true
+	if got := attempt("alice"); got != time.Second {
+		t.Errorf("Attempt() racing another got = %v, want 1s", got)
+	}
+	if got := failures("alice"); got != testPolicy.Free+1 {
+		t.Errorf("Attempt() racing another left %d failures, want only the other's %d", got, testPolicy.Free+1)
+	}
+
+	now = now.Add(time.Second)
+	if got := attempt("alice"); got != 0 {
+		t.Errorf("Attempt() after the delay got = %v, want 0", got)
+	}
+}
+
+func TestLimiterAttemptConcurrent(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	limiter := Limiter{
+		Store:  NewMemoryStore(),
+		Policy: testPolicy,
+		Now:    func() time.Time { return now },
+	}
+
+	allowed := make(chan bool)
+	for range 50 {
+		go func() {
+			wait, err := limiter.Attempt(context.Background(), "alice")
+			allowed <- err == nil && wait == 0
+		}()
+	}
+	got := 0
+	for range 50 {
+		if <-allowed {
+			got++
+		}
+	}
+	if got != testPolicy.Free+1 {
+		t.Errorf("Attempt() let %d of 50 attempts at once go ahead, want %d", got, testPolicy.Free+1)
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	limiter := Limiter{
+		Store:  NewMemoryStore(),
+		Policy: testPolicy,
+		Now:    func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	lockout := func() bool {
+		t.Helper()
+		_, locked, err := limiter.Lockout(ctx, "alice")
+		if err != nil {
+			t.Fatalf("Lockout() error = %v", err)
+		}
+		return locked
+	}
+	fail := func(times int) {
+		t.Helper()
+		for range times {
+			_, _, err := limiter.Fail(ctx, "alice")
+			if err != nil {
+				t.Fatalf("Fail() error = %v", err)
+			}
+		}
+	}
+
+	fail(testPolicy.LockoutAfter - 1)
+	if lockout() {
+		t.Errorf("Lockout() before LockoutAfter got = true, want false")
+	}
+	// two failures stepping past the threshold at once
+	fail(2)
+	if !lockout() {
+		t.Errorf("Lockout() past LockoutAfter got = false, want true")
+	}
+	if lockout() {
+		t.Errorf("Lockout() reported twice")
+	}
+
+	now = now.Add(3 * time.Hour)
+	fail(testPolicy.LockoutAfter)
+	if !lockout() {
+		t.Errorf("Lockout() after starting over got = false, want true")
+	}
+}
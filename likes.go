@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+type Like struct {
+	UserID  uuid.UUID `json:"user_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+type LikesPage struct {
+	Users      []Like `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func (cfg *apiConfig) likeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, chirpID, ok := cfg.likeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.dbQueries.CreateChirpLike(context.Background(), database.CreateChirpLikeParams{
+		ChirpID: chirpID,
+		UserID:  userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Liking chirp failed", err)
+		return
+	}
+
+	cfg.likeRespond(w, userID, chirpID)
+}
+
+func (cfg *apiConfig) unlikeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, chirpID, ok := cfg.likeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.dbQueries.DeleteChirpLike(context.Background(), database.DeleteChirpLikeParams{
+		ChirpID: chirpID,
+		UserID:  userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unliking chirp failed", err)
+		return
+	}
+
+	cfg.likeRespond(w, userID, chirpID)
+}
+
+// likeRequest authenticates a like or unlike and checks that the chirp can
+// be liked, responding with an error and returning false otherwise.
+func (cfg *apiConfig) likeRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	chirpDB, err := cfg.dbQueries.GetChirpByID(context.Background(), chirpID)
+	if err != nil || chirpDB.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, chirpID, true
+}
+
+// likeRespond answers with the chirp as it is after the like or unlike, so
+// the client gets the fresh like_count.
+func (cfg *apiConfig) likeRespond(w http.ResponseWriter, userID, chirpID uuid.UUID) {
+	chirpDB, err := cfg.dbQueries.GetChirpByID(context.Background(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+
+	cfg.chirpRespond(w, http.StatusOK, chirpDB, userID)
+}
+
+func (cfg *apiConfig) likesHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	_, err = cfg.dbQueries.GetChirpByID(context.Background(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+
+	likes, err := cfg.dbQueries.GetChirpLikesPage(context.Background(), database.GetChirpLikesPageParams{
+		ChirpID:         chirpID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving likes", err)
+		return
+	}
+
+	likes, nextCursor := pageTrim(likes, page, func(like database.ChirpLike) pageCursor {
+		return pageCursor{CreatedAt: like.CreatedAt, ID: like.UserID}
+	})
+
+	users := make([]Like, 0, len(likes))
+	for _, like := range likes {
+		users = append(users, Like{UserID: like.UserID, LikedAt: like.CreatedAt})
+	}
+
+	respondWithJSON(w, http.StatusOK, LikesPage{Users: users, NextCursor: nextCursor})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/el-damiano/bootdev-http-server/internal/chirptext"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	chirpLenMax          = 140
+	chirpLenMaxChirpyRed = 280
+)
+
+// ChirpLimits are the limits on chirps. MaxLength applies to whoever asked,
+// the others are there for comparing tiers.
+type ChirpLimits struct {
+	MaxLength          int `json:"max_length"`
+	MaxLengthDefault   int `json:"max_length_default"`
+	MaxLengthChirpyRed int `json:"max_length_chirpy_red"`
+	URLLength          int `json:"url_length"`
+}
+
+func chirpLimits(lenMax int) ChirpLimits {
+	return ChirpLimits{
+		MaxLength:          lenMax,
+		MaxLengthDefault:   chirpLenMax,
+		MaxLengthChirpyRed: chirpLenMaxChirpyRed,
+		URLLength:          chirptext.URLLength,
+	}
+}
+
+type chirpLengthError struct {
+	Length    int
+	MaxLength int
+}
+
+func (e *chirpLengthError) Error() string {
+	return fmt.Sprintf("Chirp is too long: %d characters, the limit is %d", e.Length, e.MaxLength)
+}
+
+// chirpLenMaxFor returns the longest chirp the user may post.
+func (cfg *apiConfig) chirpLenMaxFor(userID uuid.UUID) (int, error) {
+	user, err := cfg.dbQueries.GetUserByID(context.Background(), userID)
+	if err != nil {
+		return 0, err
+	}
+	return chirpLenMaxOf(user), nil
+}
+
+func chirpLenMaxOf(user database.User) int {
+	if user.IsChirpyRed {
+		return chirpLenMaxChirpyRed
+	}
+	return chirpLenMax
+}
+
+// respondWithChirpInvalid reports why chirpValidate failed, along with the
+// limits when the chirp was too long.
+func respondWithChirpInvalid(w http.ResponseWriter, err error) {
+	var lengthErr *chirpLengthError
+	if !errors.As(err, &lengthErr) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	type errorResponse struct {
+		Error  string      `json:"error"`
+		Length int         `json:"length"`
+		Limits ChirpLimits `json:"limits"`
+	}
+	respondWithJSON(w, http.StatusBadRequest, errorResponse{
+		Error:  lengthErr.Error(),
+		Length: lengthErr.Length,
+		Limits: chirpLimits(lengthErr.MaxLength),
+	})
+}
+
+func (cfg *apiConfig) limitsHandler(w http.ResponseWriter, r *http.Request) {
+	lenMax := chirpLenMax
+
+	viewerID := cfg.viewer(r)
+	if viewerID.Valid {
+		var err error
+		lenMax, err = cfg.chirpLenMaxFor(viewerID.UUID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error retrieving the limits", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpLimits(lenMax))
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/el-damiano/bootdev-http-server/internal/mail"
+	"github.com/el-damiano/bootdev-http-server/internal/throttle"
+	"github.com/google/uuid"
+)
+
+// Failed logins are throttled per account and per client address. Addresses
+// get more leeway, many people may share one.
+var (
+	loginAccountPolicy = throttle.Policy{
+		Free:         3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockoutAfter: 10,
+		Lockout:      15 * time.Minute,
+		Window:       time.Hour,
+	}
+	loginIPPolicy = throttle.Policy{
+		Free:         20,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockoutAfter: 100,
+		Lockout:      time.Hour,
+		Window:       time.Hour,
+	}
+)
+
+// dbThrottleStore is a throttle.Store shared by every server using the
+// database.
+type dbThrottleStore struct {
+	dbQueries *database.Queries
+
+	mu     sync.Mutex
+	pruned time.Time
+}
+
+func (s *dbThrottleStore) Fail(ctx context.Context, key string, at, since time.Time) (throttle.Record, error) {
+	s.prune(ctx, at, since)
+
+	row, err := s.dbQueries.FailLogin(ctx, database.FailLoginParams{
+		Key:      key,
+		FailedAt: at.UTC(),
+		Since:    since.UTC(),
+	})
+	if err != nil {
+		return throttle.Record{}, err
+	}
+	return throttle.Record{Failures: int(row.Failures), LastFailure: row.LastFailureAt, Notified: row.Notified}, nil
+}
+
+// prune deletes the rows nobody failed since, once every window.
+func (s *dbThrottleStore) prune(ctx context.Context, at, since time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pruned.Before(since) {
+		return
+	}
+	s.pruned = at
+
+	err := s.dbQueries.DeleteLoginFailuresBefore(ctx, since.UTC())
+	if err != nil {
+		log.Printf("Error pruning login failures: %s", err)
+	}
+}
+
+func (s *dbThrottleStore) Get(ctx context.Context, key string) (throttle.Record, error) {
+	row, err := s.dbQueries.GetLoginFailures(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return throttle.Record{}, nil
+	}
+	if err != nil {
+		return throttle.Record{}, err
+	}
+	return throttle.Record{Failures: int(row.Failures), LastFailure: row.LastFailureAt, Notified: row.Notified}, nil
+}
+
+func (s *dbThrottleStore) Forgive(ctx context.Context, key string) error {
+	return s.dbQueries.ForgiveLoginFailure(ctx, key)
+}
+
+func (s *dbThrottleStore) Notify(ctx context.Context, key string) (bool, error) {
+	rows, err := s.dbQueries.NotifyLoginFailures(ctx, key)
+	return rows > 0, err
+}
+
+func (s *dbThrottleStore) Reset(ctx context.Context, key string) error {
+	return s.dbQueries.ResetLoginFailures(ctx, key)
+}
+
+// throttleStoreFromEnv counts failed logins in the database, unless told to
+// keep them in memory.
+func throttleStoreFromEnv(dbQueries *database.Queries) (throttle.Store, error) {
+	switch store := os.Getenv("LOGIN_THROTTLE_STORE"); store {
+	case "", "postgres":
+		return &dbThrottleStore{dbQueries: dbQueries}, nil
+	case "memory":
+		return throttle.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown LOGIN_THROTTLE_STORE %q, expected postgres or memory", store)
+	}
+}
+
+func loginAccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginAttempt counts a login to the account with the email from the
+// client's address as failed before the password is checked, so guesses sent
+// at the same time can't all get in before the first one fails. It returns
+// how long the client has to wait instead, if it has to. A login that goes
+// ahead is then settled with loginFailed, loginPasswordCorrect or
+// loginSucceeded.
+func (cfg *apiConfig) loginAttempt(r *http.Request, email string) (time.Duration, error) {
+	keyIP := loginIPKey(clientIP(r))
+	wait, err := cfg.loginIPThrottle.Attempt(context.Background(), keyIP)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+
+	wait, err = cfg.loginAccountThrottle.Attempt(context.Background(), loginAccountKey(email))
+	if err == nil && wait > 0 {
+		// nothing was guessed from the address either
+		err = cfg.loginIPThrottle.Forgive(context.Background(), keyIP)
+	}
+	return wait, err
+}
+
+func respondWithLoginThrottled(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed logins, try again later", nil)
+}
+
+// loginFailed settles a failed login, already counted by loginAttempt. The
+// owner of the account, if there is one, is told once when it gets locked
+// out. Errors are only logged, the login failed anyway.
+func (cfg *apiConfig) loginFailed(r *http.Request, email string, user *database.User) {
+	if user == nil {
+		return
+	}
+
+	record, locked, err := cfg.loginAccountThrottle.Lockout(context.Background(), loginAccountKey(email))
+	if err != nil {
+		log.Printf("Error checking for a lockout: %s", err)
+		return
+	}
+	if !locked {
+		return
+	}
+
+	ip := clientIP(r)
+	err = securityEventLog(cfg.dbQueries, user.ID, securityEventAccountLocked,
+		fmt.Sprintf("locked out after %d failed logins, the last from %s", record.Failures, ip))
+	if err != nil {
+		log.Printf("Error recording a lockout: %s", err)
+	}
+	cfg.mailSend(mail.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy account was locked",
+		Body: fmt.Sprintf("Someone failed to log in to your Chirpy account %d times in a row, the\n"+
+			"last time from %s, so logging in is blocked for %s.\n\n"+
+			"If it wasn't you, someone may be guessing your password. Consider\n"+
+			"resetting it with POST /api/password/forgot once the block is over.\n",
+			record.Failures, ip, loginAccountPolicy.Lockout),
+	})
+}
+
+// loginPasswordCorrect settles a login with the right password that still
+// needs a second factor, taking back what loginAttempt counted without
+// forgetting earlier failures of the account, those still throttle guesses
+// at the code.
+func (cfg *apiConfig) loginPasswordCorrect(r *http.Request, email string) {
+	err := cfg.loginIPThrottle.Forgive(context.Background(), loginIPKey(clientIP(r)))
+	if err == nil {
+		err = cfg.loginAccountThrottle.Forgive(context.Background(), loginAccountKey(email))
+	}
+	if err != nil {
+		log.Printf("Error taking back a login attempt: %s", err)
+	}
+}
+
+// loginSucceeded settles a successful login, forgetting the failed logins of
+// the account. Those of the client's address are kept, a successful login to
+// one account says nothing about guesses at others.
+func (cfg *apiConfig) loginSucceeded(r *http.Request, email string) {
+	err := cfg.loginIPThrottle.Forgive(context.Background(), loginIPKey(clientIP(r)))
+	if err != nil {
+		log.Printf("Error taking back a login attempt: %s", err)
+	}
+	err = cfg.loginAccountThrottle.Reset(context.Background(), loginAccountKey(email))
+	if err != nil {
+		log.Printf("Error resetting failed logins: %s", err)
+	}
+}
+
+// currentPasswordCheck checks the current password of a logged in user,
+// throttled like logins, or an access token would be a way to guess it. It
+// responds itself when it fails.
+func (cfg *apiConfig) currentPasswordCheck(w http.ResponseWriter, r *http.Request, user database.User, password string) bool {
+	wait, err := cfg.loginAttempt(r, user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error checking the current password", err)
+		return false
+	}
+	if wait > 0 {
+		respondWithLoginThrottled(w, wait)
+		return false
+	}
+
+	_, err = cfg.passwords.Check(password, user.HashedPassword)
+	if err != nil {
+		cfg.loginFailed(r, user.Email, &user)
+		respondWithError(w, http.StatusForbidden, "Current password is incorrect", err)
+		return false
+	}
+	cfg.loginSucceeded(r, user.Email)
+	return true
+}
+
+func (cfg *apiConfig) userUnlockHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(context.Background(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error unlocking the user", err)
+		return
+	}
+
+	err = cfg.loginAccountThrottle.Reset(context.Background(), loginAccountKey(user.Email))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error unlocking the user", err)
+		return
+	}
+
+	err = securityEventLog(cfg.dbQueries, user.ID, securityEventAccountUnlocked, "unlocked by an admin")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error unlocking the user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loginFail fails to log in as often as told, waiting out the delays in
+// between.
+func (api *testAPI) loginFail(t *testing.T, email string, failures int) {
+	t.Helper()
+	for range failures {
+		api.clock.Add(loginAccountPolicy.MaxDelay)
+		res := api.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": "not-the-password-1"})
+		if res.code != http.StatusUnauthorized {
+			t.Fatalf("POST /api/login with a wrong password got %d %s, want %d", res.code, res.body, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestUserLoginThrottle(t *testing.T) {
+	db := testDB(t)
+
+	cases := map[string]struct {
+		failures       int
+		wait           time.Duration
+		password       string
+		wantCode       int
+		wantRetryAfter string
+	}{
+		"free failures": {
+			failures: 3,
+			password: testPassword,
+			wantCode: http.StatusOK,
+		},
+		"delayed": {
+			failures:       4,
+			password:       testPassword,
+			wantCode:       http.StatusTooManyRequests,
+			wantRetryAfter: "1",
+		},
+		"delay over": {
+			failures: 4,
+			wait:     time.Second,
+			password: testPassword,
+			wantCode: http.StatusOK,
+		},
+		"delay doubled": {
+			failures:       5,
+			password:       testPassword,
+			wantCode:       http.StatusTooManyRequests,
+			wantRetryAfter: "2",
+		},
+		"locked out": {
+			failures:       10,
+			wait:           time.Minute,
+			password:       testPassword,
+			wantCode:       http.StatusTooManyRequests,
+			wantRetryAfter: "840",
+		},
+		"locked out guessing": {
+			failures:       10,
+			password:       "not-the-password-1",
+			wantCode:       http.StatusTooManyRequests,
+			wantRetryAfter: "900",
+		},
+		"lockout over": {
+			failures: 10,
+			wait:     loginAccountPolicy.Lockout,
+			password: testPassword,
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			// failures of one case don't count against the address in others
+			api := newTestAPI(t, db)
+			email := api.userCreate(t)
+			api.loginFail(t, email, c.failures)
+			api.clock.Add(c.wait)
+
+			res := api.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": c.password})
+			if res.code != c.wantCode {
+				t.Fatalf("POST /api/login got %d %s, want %d", res.code, res.body, c.wantCode)
+			}
+			if got := res.header.Get("Retry-After"); got != c.wantRetryAfter {
+				t.Errorf("POST /api/login Retry-After = %q, want %q", got, c.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestUserLockout(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	email := api.userCreate(t)
+	user, err := api.cfg.dbQueries.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api.loginFail(t, email, loginAccountPolicy.LockoutAfter)
+	if got := api.securityEvents(t, user.ID, securityEventAccountLocked); got != 1 {
+		t.Errorf("got %d %s security events, want 1", got, securityEventAccountLocked)
+	}
+
+	// emails are sent in the background
+	told := false
+	for deadline := time.Now().Add(time.Second); !told && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, msg := range api.mailer.Messages() {
+			told = told || msg.To == email && msg.Subject == "Your Chirpy account was locked"
+		}
+	}
+	if !told {
+		t.Errorf("the owner wasn't emailed about the lockout, got %+v", api.mailer.Messages())
+	}
+
+	path := fmt.Sprintf("/admin/users/%s/unlock", user.ID)
+	res := api.request(t, "POST", path, "", nil)
+	if res.code != http.StatusUnauthorized {
+		t.Errorf("POST %s without the admin key got %d, want %d", path, res.code, http.StatusUnauthorized)
+	}
+	res = api.request(t, "POST", path, "ApiKey "+testAdminKey, nil)
+	if res.code != http.StatusNoContent {
+		t.Fatalf("POST %s got %d %s, want %d", path, res.code, res.body, http.StatusNoContent)
+	}
+	api.login(t, email, testPassword)
+}
+
+// loginBurst sends wrong passwords all at once, returning how many of them
+// were checked rather than throttled.
+func (api *testAPI) loginBurst(t *testing.T, email string, logins int) int {
+	t.Helper()
+	codes := make([]int, logins)
+	wg := sync.WaitGroup{}
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := api.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": "not-the-password-1"})
+			codes[i] = res.code
+		}()
+	}
+	wg.Wait()
+
+	checked := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusUnauthorized:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("POST /api/login with a wrong password got %d, want %d or %d", code, http.StatusUnauthorized, http.StatusTooManyRequests)
+		}
+	}
+	return checked
+}
+
+func TestUserLoginBurst(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	email := api.userCreate(t)
+	user, err := api.cfg.dbQueries.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// guesses sent together are throttled like ones sent in a row
+	if got := api.loginBurst(t, email, 20); got != loginAccountPolicy.Free+1 {
+		t.Errorf("a burst of 20 logins had %d passwords checked, want %d", got, loginAccountPolicy.Free+1)
+	}
+
+	api.loginFail(t, email, loginAccountPolicy.LockoutAfter-loginAccountPolicy.Free-2)
+	api.clock.Add(loginAccountPolicy.MaxDelay)
+	if got := api.loginBurst(t, email, 10); got != 1 {
+		t.Errorf("a burst of 10 logins past the delay had %d passwords checked, want 1", got)
+	}
+	if got := api.securityEvents(t, user.ID, securityEventAccountLocked); got != 1 {
+		t.Errorf("got %d %s security events, want 1", got, securityEventAccountLocked)
+	}
+}
+
+func TestCurrentPasswordThrottle(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	email := api.userCreate(t)
+	user := api.login(t, email, testPassword)
+	change := func(currentPassword string) testResponse {
+		return api.request(t, "PATCH", "/api/users/me", bearer(user.Token),
+			map[string]string{"password": "x7#kP9!qL2@m", "current_password": currentPassword})
+	}
+
+	for range loginAccountPolicy.Free + 1 {
+		api.clock.Add(loginAccountPolicy.MaxDelay)
+		res := change("not-the-password-1")
+		if res.code != http.StatusForbidden {
+			t.Fatalf("PATCH /api/users/me with a wrong current password got %d %s, want %d", res.code, res.body, http.StatusForbidden)
+		}
+	}
+
+	// an access token is no way around the throttling of logins
+	res := change(testPassword)
+	if res.code != http.StatusTooManyRequests || res.header.Get("Retry-After") != "1" {
+		t.Errorf("PATCH /api/users/me got %d with Retry-After %q, want %d with 1", res.code, res.header.Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	res = api.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": testPassword})
+	if res.code != http.StatusTooManyRequests {
+		t.Errorf("POST /api/login got %d, want the failures to count for logins with %d", res.code, http.StatusTooManyRequests)
+	}
+
+	api.clock.Add(time.Second)
+	res = change(testPassword)
+	if res.code != http.StatusOK {
+		t.Errorf("PATCH /api/users/me after the delay got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+}
@@ -2,11 +2,20 @@ package main
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
 	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/el-damiano/bootdev-http-server/internal/mail"
+	"github.com/el-damiano/bootdev-http-server/internal/media"
+	"github.com/el-damiano/bootdev-http-server/internal/throttle"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -21,48 +30,339 @@ func main() {
 	tokenSecret := os.Getenv("SECRET")
 	platform := os.Getenv("PLATFORM")
 	polkaKey := os.Getenv("POLKA_KEY")
+	adminKey := os.Getenv("ADMIN_KEY")
+	contentFilterPath := os.Getenv("CONTENT_FILTER_FILE")
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	signingAlgorithm := os.Getenv("JWT_ALGORITHM")
+	if signingAlgorithm == "" {
+		signingAlgorithm = auth.AlgorithmEdDSA
+	}
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatalf("Error opening database: %s", err)
 	}
+	dbQueries := database.New(db)
+
+	secrets, err := secretBoxFromEnv()
+	if err != nil {
+		log.Fatalf("Error setting up secrets: %s", err)
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rotate-key":
+			err = rotateKeyCommand(db, dbQueries, secrets, os.Args[2:], signingAlgorithm)
+			if err != nil {
+				log.Fatalf("Error rotating the signing key: %s", err)
+			}
+		case "breached-filter":
+			err = breachedFilterCommand(os.Args[2:])
+			if err != nil {
+				log.Fatalf("Error building the breached password filter: %s", err)
+			}
+		default:
+			log.Fatalf("Unknown command %q, the commands are rotate-key and breached-filter", os.Args[1])
+		}
+		return
+	}
+
+	contentFilter, err := loadContentFilter(dbQueries, contentFilterPath)
+	if err != nil {
+		log.Fatalf("Error loading content filter: %s", err)
+	}
+
+	blobStore, err := media.NewFileStore(mediaDir)
+	if err != nil {
+		log.Fatalf("Error opening media directory: %s", err)
+	}
+
+	mailer, err := mailerFromEnv()
+	if err != nil {
+		log.Fatalf("Error setting up email: %s", err)
+	}
+
+	passwords, err := passwordsFromEnv()
+	if err != nil {
+		log.Fatalf("Error setting up password hashing: %s", err)
+	}
+
+	passwordPolicy, err := passwordPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Error setting up the password policy: %s", err)
+	}
+
+	throttleStore, err := throttleStoreFromEnv(dbQueries)
+	if err != nil {
+		log.Fatalf("Error setting up login throttling: %s", err)
+	}
 
 	const port = "8080"
 	const filePath = "."
 	apiCfg := &apiConfig{
-		dbQueries:   database.New(db),
-		platform:    platform,
-		tokenSecret: tokenSecret,
-		polkaKey:    polkaKey,
+		requireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		db:                   db,
+		dbQueries:            dbQueries,
+		platform:             platform,
+		keyRing:              auth.NewKeyRing(tokenSecret),
+		passwords:            passwords,
+		passwordPolicy:       passwordPolicy,
+		secrets:              secrets,
+		loginAccountThrottle: &throttle.Limiter{Store: throttleStore, Policy: loginAccountPolicy},
+		loginIPThrottle:      &throttle.Limiter{Store: throttleStore, Policy: loginIPPolicy},
+		signingAlgorithm:     signingAlgorithm,
+		polkaKey:             polkaKey,
+		adminKey:             adminKey,
+		contentFilter:        contentFilter,
+		blobStore:            blobStore,
+		mailer:               mailer,
 	}
-	dir := http.Dir(filePath)
+	// tokens and lockouts expire by the same clock as everything else
+	apiCfg.keyRing.Now = apiCfg.now
+	apiCfg.loginAccountThrottle.Now = apiCfg.now
+	apiCfg.loginIPThrottle.Now = apiCfg.now
 
+	err = apiCfg.sealSigningKeys()
+	if err != nil {
+		log.Fatalf("Error sealing signing keys: %s", err)
+	}
+	err = apiCfg.sealTOTPSecrets()
+	if err != nil {
+		log.Fatalf("Error sealing two-factor secrets: %s", err)
+	}
+	err = apiCfg.createFirstSigningKey()
+	if err != nil {
+		log.Fatalf("Error making the first signing key: %s", err)
+	}
+	err = apiCfg.loadSigningKeys()
+	if err != nil {
+		log.Fatalf("Error loading signing keys: %s", err)
+	}
+	go apiCfg.reloadSigningKeys()
+	if tokenSecret != "" {
+		legacyUntil := apiCfg.keyRing.LegacyUntil()
+		if apiCfg.now().Before(legacyUntil) {
+			log.Printf("Warning: accepting access tokens signed with SECRET until %s, remove it after that", legacyUntil.Format(time.RFC3339))
+		} else {
+			log.Printf("Warning: SECRET is set but no longer accepted since %s, remove it", legacyUntil.Format(time.RFC3339))
+		}
+	}
+
+	server := &http.Server{
+		Handler: apiCfg.routes(filePath),
+		Addr:    ":" + port,
+	}
+
+	log.Printf("Serving files from %s on port: %s\n", filePath, port)
+	log.Fatal(server.ListenAndServe())
+}
+
+// routes serves the API, and the files in filePath under /app/.
+func (cfg *apiConfig) routes(filePath string) *http.ServeMux {
 	serveMux := http.NewServeMux()
-	fileHandler := http.StripPrefix("/app", http.FileServer(dir))
-	serveMux.Handle("/app/", apiCfg.metricsMiddleware(fileHandler))
+	fileHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filePath)))
+	serveMux.Handle("/app/", cfg.metricsMiddleware(fileHandler))
 
 	serveMux.HandleFunc("GET /api/healthz", readyHandler)
+	serveMux.HandleFunc("GET /media/{key}", cfg.mediaHandler)
+	serveMux.HandleFunc("GET /.well-known/jwks.json", cfg.jwksHandler)
 
-	serveMux.HandleFunc("POST /api/users", apiCfg.userCreateHandler)
-	serveMux.HandleFunc("PUT /api/users", apiCfg.userUpdateHandler)
-	serveMux.HandleFunc("POST /api/login", apiCfg.userLoginHandler)
-	serveMux.HandleFunc("POST /api/refresh", apiCfg.tokenRefreshHandler)
-	serveMux.HandleFunc("POST /api/revoke", apiCfg.tokenRevokeHandler)
+	serveMux.HandleFunc("POST /api/users", cfg.userCreateHandler)
+	serveMux.HandleFunc("PUT /api/users", cfg.userUpdateHandler)
+	serveMux.HandleFunc("PATCH /api/users/me", cfg.userPatchHandler)
+	serveMux.HandleFunc("POST /api/users/verify", cfg.userVerifyHandler)
+	serveMux.HandleFunc("POST /api/users/verify/resend", cfg.userVerifyResendHandler)
+	serveMux.HandleFunc("POST /api/users/me/totp", cfg.totpEnrollHandler)
+	serveMux.HandleFunc("POST /api/users/me/totp/confirm", cfg.totpConfirmHandler)
+	serveMux.HandleFunc("POST /api/users/me/totp/recovery-codes", cfg.totpRecoveryCodesHandler)
+	serveMux.HandleFunc("DELETE /api/users/me/totp", cfg.totpDisableHandler)
+	serveMux.HandleFunc("GET /api/users/{idOrHandle}", cfg.profileHandler)
+	serveMux.HandleFunc("PATCH /api/users/me/profile", cfg.withScope(auth.ScopeProfileWrite, cfg.profileUpdateHandler))
+	serveMux.HandleFunc("PUT /api/users/me/avatar", cfg.withScope(auth.ScopeProfileWrite, cfg.avatarSetHandler))
+	serveMux.HandleFunc("DELETE /api/users/me/avatar", cfg.withScope(auth.ScopeProfileWrite, cfg.avatarDeleteHandler))
+	serveMux.HandleFunc("POST /api/users/{userID}/follow", cfg.withScope(auth.ScopeProfileWrite, cfg.followHandler))
+	serveMux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.withScope(auth.ScopeProfileWrite, cfg.unfollowHandler))
+	serveMux.HandleFunc("GET /api/users/{userID}/followers", cfg.followersHandler)
+	serveMux.HandleFunc("GET /api/users/{userID}/following", cfg.followingHandler)
+	serveMux.HandleFunc("POST /api/login", cfg.userLoginHandler)
+	serveMux.HandleFunc("POST /api/login/mfa", cfg.loginMFAHandler)
+	serveMux.HandleFunc("POST /api/refresh", cfg.tokenRefreshHandler)
+	serveMux.HandleFunc("POST /api/revoke", cfg.tokenRevokeHandler)
+	serveMux.HandleFunc("GET /api/sessions", cfg.sessionsHandler)
+	serveMux.HandleFunc("DELETE /api/sessions/{id}", cfg.sessionDeleteHandler)
+	serveMux.HandleFunc("POST /api/sessions/revoke-all", cfg.sessionsRevokeAllHandler)
+	serveMux.HandleFunc("GET /api/users/me/api-keys", cfg.apiKeysHandler)
+	serveMux.HandleFunc("POST /api/users/me/api-keys", cfg.apiKeyCreateHandler)
+	serveMux.HandleFunc("DELETE /api/users/me/api-keys/{id}", cfg.apiKeyDeleteHandler)
+	serveMux.HandleFunc("POST /api/password/forgot", cfg.passwordForgotHandler)
+	serveMux.HandleFunc("POST /api/password/reset", cfg.passwordResetHandler)
 
-	serveMux.HandleFunc("POST /api/chirps", apiCfg.chirpCreateHandler)
-	serveMux.HandleFunc("GET /api/chirps", apiCfg.chirpsHandler)
-	serveMux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.chirpsHandler)
-	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.chirpsDeleteHandler)
+	serveMux.HandleFunc("POST /api/chirps", cfg.withScope(auth.ScopeChirpsWrite, cfg.chirpCreateHandler))
+	serveMux.HandleFunc("GET /api/chirps", cfg.withScope(auth.ScopeChirpsRead, cfg.chirpsHandler))
+	serveMux.HandleFunc("GET /api/chirps/search", cfg.withScope(auth.ScopeChirpsRead, cfg.chirpsSearchHandler))
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}", cfg.withScope(auth.ScopeChirpsRead, cfg.chirpsHandler))
+	serveMux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.withScope(auth.ScopeChirpsWrite, cfg.chirpUpdateHandler))
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.withScope(auth.ScopeChirpsWrite, cfg.chirpsDeleteHandler))
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}/revisions", cfg.withScope(auth.ScopeChirpsRead, cfg.chirpRevisionsHandler))
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}/replies", cfg.withScope(auth.ScopeChirpsRead, cfg.chirpRepliesHandler))
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/likes", cfg.withScope(auth.ScopeChirpsWrite, cfg.likeHandler))
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}/likes", cfg.withScope(auth.ScopeChirpsWrite, cfg.unlikeHandler))
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}/likes", cfg.withScope(auth.ScopeChirpsRead, cfg.likesHandler))
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", cfg.withScope(auth.ScopeChirpsWrite, cfg.rechirpHandler))
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", cfg.withScope(auth.ScopeChirpsWrite, cfg.unrechirpHandler))
 
-	serveMux.HandleFunc("POST /api/polka/webhooks", apiCfg.polkaHandler)
+	serveMux.HandleFunc("GET /api/limits", cfg.withScope(auth.ScopeChirpsRead, cfg.limitsHandler))
+	serveMux.HandleFunc("POST /api/media", cfg.withScope(auth.ScopeChirpsWrite, cfg.mediaUploadHandler))
 
-	serveMux.HandleFunc("GET /admin/metrics", apiCfg.metricsHandler)
-	serveMux.HandleFunc("POST /admin/reset", apiCfg.metricsResetHandler)
+	serveMux.HandleFunc("GET /api/timeline", cfg.withScope(auth.ScopeChirpsRead, cfg.timelineHandler))
+	serveMux.HandleFunc("GET /api/users/me/mentions", cfg.withScope(auth.ScopeChirpsRead, cfg.mentionsHandler))
 
-	server := &http.Server{
-		Handler: serveMux,
-		Addr:    ":" + port,
+	serveMux.HandleFunc("GET /api/hashtags/trending", cfg.withScope(auth.ScopeChirpsRead, cfg.hashtagsTrendingHandler))
+	serveMux.HandleFunc("GET /api/hashtags/{tag}/chirps", cfg.withScope(auth.ScopeChirpsRead, cfg.hashtagChirpsHandler))
+
+	serveMux.HandleFunc("POST /api/polka/webhooks", cfg.polkaHandler)
+
+	serveMux.HandleFunc("GET /oauth/authorize", cfg.oauthAuthorizeHandler)
+	serveMux.HandleFunc("POST /oauth/authorize", cfg.oauthConsentHandler)
+	serveMux.HandleFunc("POST /oauth/token", cfg.oauthTokenHandler)
+	serveMux.HandleFunc("POST /oauth/introspect", cfg.oauthIntrospectHandler)
+	serveMux.HandleFunc("POST /oauth/revoke", cfg.oauthRevokeHandler)
+
+	serveMux.HandleFunc("GET /admin/metrics", cfg.metricsHandler)
+	serveMux.HandleFunc("POST /admin/reset", cfg.metricsResetHandler)
+	serveMux.HandleFunc("GET /admin/filter/terms", cfg.filterTermsHandler)
+	serveMux.HandleFunc("POST /admin/filter/terms", cfg.filterTermSetHandler)
+	serveMux.HandleFunc("DELETE /admin/filter/terms/{term}", cfg.filterTermDeleteHandler)
+	serveMux.HandleFunc("GET /admin/flags", cfg.chirpFlagsHandler)
+	serveMux.HandleFunc("GET /admin/keys", cfg.signingKeysHandler)
+	serveMux.HandleFunc("POST /admin/users/{id}/unlock", cfg.userUnlockHandler)
+	serveMux.HandleFunc("POST /admin/keys/rotate", cfg.signingKeyRotateHandler)
+	serveMux.HandleFunc("GET /admin/oauth/clients", cfg.oauthClientsHandler)
+	serveMux.HandleFunc("POST /admin/oauth/clients", cfg.oauthClientCreateHandler)
+	serveMux.HandleFunc("DELETE /admin/oauth/clients/{id}", cfg.oauthClientDeleteHandler)
+
+	return serveMux
+}
+
+// mailerFromEnv sends emails through SMTP_HOST when it's set and writes them
+// to files in MAIL_DIR otherwise.
+func mailerFromEnv() (mail.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <chirpy@localhost>"
 	}
 
-	log.Printf("Serving files from %s on port: %s\n", filePath, port)
-	log.Fatal(server.ListenAndServe())
+	smtpHost := os.Getenv("SMTP_HOST")
+	if smtpHost != "" {
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		return mail.NewSMTPMailer(smtpHost, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	}
+
+	mailDir := os.Getenv("MAIL_DIR")
+	if mailDir == "" {
+		mailDir = "mail"
+	}
+	return mail.NewFileMailer(mailDir, from)
+}
+
+// secretBoxFromEnv seals secrets with SECRETS_KEY, 32 random bytes in
+// base64.
+func secretBoxFromEnv() (*auth.SecretBox, error) {
+	value := os.Getenv("SECRETS_KEY")
+	if value == "" {
+		return nil, errors.New("SECRETS_KEY isn't set, make one with: openssl rand -base64 32")
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("SECRETS_KEY isn't base64: %w", err)
+	}
+	return auth.NewSecretBox(key)
+}
+
+// openSecret opens a secret sealed for what it belongs to. Secrets stored in
+// the clear by versions from before they were sealed are returned as they
+// are, until they're sealed at the next start.
+func openSecret(secrets *auth.SecretBox, value, belongsTo string) (string, error) {
+	if !auth.IsSealed(value) {
+		return value, nil
+	}
+	return secrets.Open(value, belongsTo)
+}
+
+// passwordsFromEnv hashes passwords with argon2id, using the default
+// parameters unless overridden.
+func passwordsFromEnv() (*auth.Passwords, error) {
+	params := auth.DefaultArgon2idParams
+
+	for name, param := range map[string]*uint32{
+		"ARGON2_MEMORY":     &params.Memory,
+		"ARGON2_ITERATIONS": &params.Iterations,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || parsed == 0 {
+			return nil, fmt.Errorf("%s must be a positive number, got %q", name, value)
+		}
+		*param = uint32(parsed)
+	}
+
+	if value := os.Getenv("ARGON2_PARALLELISM"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || parsed == 0 {
+			return nil, fmt.Errorf("ARGON2_PARALLELISM must be a number from 1 to 255, got %q", value)
+		}
+		params.Parallelism = uint8(parsed)
+	}
+
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return nil, fmt.Errorf("ARGON2_MEMORY must be at least 8 KiB per ARGON2_PARALLELISM")
+	}
+	return auth.NewPasswords(params), nil
+}
+
+// passwordPolicyFromEnv applies the default password policy unless
+// overridden, checking passwords against the breached password filter in
+// BREACHED_PASSWORDS_FILE when given.
+func passwordPolicyFromEnv() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > policy.MaxLength {
+			return policy, fmt.Errorf("PASSWORD_MIN_LENGTH must be a number from 1 to %d, got %q", policy.MaxLength, value)
+		}
+		policy.MinLength = parsed
+	}
+
+	if value := os.Getenv("PASSWORD_MIN_STRENGTH"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > 4 {
+			return policy, fmt.Errorf("PASSWORD_MIN_STRENGTH must be a number from 0 to 4, got %q", value)
+		}
+		policy.MinStrength = parsed
+	}
+
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		return policy, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return policy, err
+	}
+	defer file.Close()
+	breached, err := auth.ReadBloomFilter(file)
+	if err != nil {
+		return policy, fmt.Errorf("%s: %w", path, err)
+	}
+	policy.Breached = breached
+	return policy, nil
 }
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/el-damiano/bootdev-http-server/internal/mail"
+	"github.com/el-damiano/bootdev-http-server/internal/media"
+	"github.com/el-damiano/bootdev-http-server/internal/moderation"
+	"github.com/el-damiano/bootdev-http-server/internal/throttle"
+	"github.com/google/uuid"
+)
+
+const (
+	testAdminKey = "test-admin-key"
+	// testPassword is good enough for the default password policy.
+	testPassword = "gravel-otter-lantern-9"
+)
+
+// testDB opens the database in TEST_DB_URL with every migration applied,
+// skipping the test without one. Everything in it is dropped first, never
+// point it at a database you want to keep.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL isn't set")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Error opening the test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public")
+	if err != nil {
+		t.Fatalf("Error emptying the test database: %v", err)
+	}
+	migrations, err := filepath.Glob(filepath.Join("sql", "schema", "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range migrations {
+		dat, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(dat), "-- +goose Down")
+		_, err = db.Exec(up)
+		if err != nil {
+			t.Fatalf("Error migrating the test database with %s: %v", migration, err)
+		}
+	}
+	return db
+}
+
+// testClock only moves when the test moves it.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// testAPI is the API served for a test, keeping emails and failed logins in
+// memory.
+type testAPI struct {
+	cfg    *apiConfig
+	server *httptest.Server
+	client *http.Client
+	clock  *testClock
+	mailer *mail.MemoryMailer
+}
+
+// newTestAPI serves the API for the test. With a database from testDB the
+// signing keys are loaded from it like at startup. Without one, the key ring
+// gets a key of its own and only handlers that don't touch the database can
+// be tested.
+func newTestAPI(t *testing.T, db *sql.DB) *testAPI {
+	t.Helper()
+	blobStore, err := media.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &testAPI{
+		clock:  &testClock{now: time.Now()},
+		mailer: &mail.MemoryMailer{},
+	}
+	throttleStore := throttle.NewMemoryStore()
+	api.cfg = &apiConfig{
+		platform:  "dev",
+		keyRing:   auth.NewKeyRing(""),
+		passwords: auth.NewPasswords(auth.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}),
+		// the default policy, without a breached password filter
+		passwordPolicy:       auth.DefaultPasswordPolicy,
+		secrets:              testSecretBox(t),
+		loginAccountThrottle: &throttle.Limiter{Store: throttleStore, Policy: loginAccountPolicy},
+		loginIPThrottle:      &throttle.Limiter{Store: throttleStore, Policy: loginIPPolicy},
+		signingAlgorithm:     auth.AlgorithmEdDSA,
+		adminKey:             testAdminKey,
+		contentFilter:        moderation.NewWordList(),
+		blobStore:            blobStore,
+		mailer:               api.mailer,
+		clock:                api.clock.Now,
+	}
+	api.cfg.keyRing.Now = api.cfg.now
+	api.cfg.loginAccountThrottle.Now = api.cfg.now
+	api.cfg.loginIPThrottle.Now = api.cfg.now
+
+	if db != nil {
+		api.cfg.db = db
+		api.cfg.dbQueries = database.New(db)
+		err = api.cfg.createFirstSigningKey()
+		if err == nil {
+			err = api.cfg.loadSigningKeys()
+		}
+	} else {
+		var key *auth.SigningKey
+		key, err = auth.GenerateSigningKey(api.cfg.signingAlgorithm)
+		if err == nil {
+			err = api.cfg.keyRing.Load([]*auth.SigningKey{key})
+		}
+	}
+	if err != nil {
+		t.Fatalf("Error loading signing keys: %v", err)
+	}
+
+	api.server = httptest.NewServer(api.cfg.routes(t.TempDir()))
+	t.Cleanup(api.server.Close)
+	// redirects, like the ones of OAuth, are checked rather than followed
+	api.client = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return api
+}
+
+// testSecretBox seals secrets with a key of the test's own.
+func testSecretBox(t *testing.T) *auth.SecretBox {
+	t.Helper()
+	key := make([]byte, auth.SecretBoxKeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets, err := auth.NewSecretBox(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secrets
+}
+
+// testResponse is a response of the API with its body read.
+type testResponse struct {
+	code   int
+	header http.Header
+	body   []byte
+}
+
+func (res testResponse) decode(t *testing.T, v any) {
+	t.Helper()
+	err := json.Unmarshal(res.body, v)
+	if err != nil {
+		t.Fatalf("Error decoding %s: %v", res.body, err)
+	}
+}
+
+// fields returns the fields of a 422 response that failed validation.
+func (res testResponse) fields(t *testing.T) map[string]string {
+	t.Helper()
+	if res.code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d %s, want %d", res.code, res.body, http.StatusUnprocessableEntity)
+	}
+	response := struct {
+		Fields map[string]string `json:"fields"`
+	}{}
+	res.decode(t, &response)
+	return response.Fields
+}
+
+// request sends a request with the authorization, if any, and the body
+// encoded as a form if it's url.Values, as JSON otherwise.
+func (api *testAPI) request(t *testing.T, method, path, authorization string, body any) testResponse {
+	t.Helper()
+	var reqBody io.Reader
+	contentType := ""
+	switch body := body.(type) {
+	case nil:
+	case url.Values:
+		reqBody = strings.NewReader(body.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		dat, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(dat)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequest(method, api.server.URL+path, reqBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testResponse{code: resp.StatusCode, header: resp.Header, body: dat}
+}
+
+// userCreate makes a user with testPassword, returning its email.
+func (api *testAPI) userCreate(t *testing.T) string {
+	t.Helper()
+	email := uuid.NewString() + "@example.com"
+	res := api.request(t, "POST", "/api/users", "", map[string]string{"email": email, "password": testPassword})
+	if res.code != http.StatusCreated {
+		t.Fatalf("Error creating user: %d %s", res.code, res.body)
+	}
+	return email
+}
+
+// login logs in, failing the test if it doesn't work.
+func (api *testAPI) login(t *testing.T, email, password string) User {
+	t.Helper()
+	res := api.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": password})
+	if res.code != http.StatusOK {
+		t.Fatalf("Error logging in: %d %s", res.code, res.body)
+	}
+	user := User{}
+	res.decode(t, &user)
+	return user
+}
+
+// securityEvents counts the events of the user.
+func (api *testAPI) securityEvents(t *testing.T, userID uuid.UUID, event string) int {
+	t.Helper()
+	count := 0
+	err := api.cfg.db.QueryRow("SELECT count(*) FROM security_events WHERE user_id = $1 AND event = $2", userID, event).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func bearer(token string) string {
+	return "Bearer " + token
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/el-damiano/bootdev-http-server/internal/media"
+	"github.com/google/uuid"
+)
+
+const chirpMediaMax = 4
+
+// multipart headers and boundaries on top of the file itself
+const mediaUploadOverhead = 64 << 10
+
+var errMediaUnavailable = errors.New("media doesn't exist, isn't yours or is attached to another chirp")
+
+type Media struct {
+	ID           uuid.UUID `json:"id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func mediaFromDB(attachment database.MediaAttachment) Media {
+	return Media{
+		ID:           attachment.ID,
+		URL:          "/media/" + attachment.BlobKey,
+		ThumbnailURL: "/media/" + attachment.ThumbnailKey,
+		ContentType:  attachment.ContentType,
+		Width:        attachment.Width,
+		Height:       attachment.Height,
+		CreatedAt:    attachment.CreatedAt,
+	}
+}
+
+func (cfg *apiConfig) mediaUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxBytes+mediaUploadOverhead)
+	file, _, err := r.FormFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, media.ErrTooLarge.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Expected a multipart form with a 'file'", err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxBytes+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error reading the upload", err)
+		return
+	}
+
+	image, err := media.Process(data)
+	if errors.Is(err, media.ErrTooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, err.Error(), err)
+		return
+	}
+	if errors.Is(err, media.ErrUnsupportedType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error processing the image", err)
+		return
+	}
+
+	id := uuid.New()
+	blobKey := id.String() + image.Ext
+	thumbnailKey := id.String() + "_thumb" + image.Ext
+
+	err = cfg.blobStore.Put(r.Context(), blobKey, bytes.NewReader(image.Data))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving the image", err)
+		return
+	}
+	err = cfg.blobStore.Put(r.Context(), thumbnailKey, bytes.NewReader(image.Thumbnail))
+	if err != nil {
+		cfg.mediaDeleteBlobs(blobKey)
+		respondWithError(w, http.StatusInternalServerError, "Error saving the image", err)
+		return
+	}
+
+	attachment, err := cfg.dbQueries.CreateMediaAttachment(context.Background(), database.CreateMediaAttachmentParams{
+		ID:           id,
+		UserID:       userID,
+		ContentType:  image.ContentType,
+		Width:        int32(image.Width),
+		Height:       int32(image.Height),
+		SizeBytes:    int32(len(image.Data)),
+		BlobKey:      blobKey,
+		ThumbnailKey: thumbnailKey,
+	})
+	if err != nil {
+		cfg.mediaDeleteBlobs(blobKey, thumbnailKey)
+		respondWithError(w, http.StatusInternalServerError, "Error saving the image", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, mediaFromDB(attachment))
+}
+
+func (cfg *apiConfig) mediaHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	blob, err := cfg.blobStore.Open(r.Context(), key)
+	if errors.Is(err, media.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Media not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the media", err)
+		return
+	}
+	defer blob.Close()
+
+	// keys are never reused, so the content never changes
+	w.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(key)))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, err = io.Copy(w, blob)
+	if err != nil {
+		log.Printf("Error writing media: %s", err)
+	}
+}
+
+// chirpAttachMedia attaches the user's uploads to a new chirp in the order
+// given.
+func chirpAttachMedia(qtx *database.Queries, chirp database.Chirp, mediaIDs []uuid.UUID) error {
+	for i, mediaID := range mediaIDs {
+		rows, err := qtx.AttachMedia(context.Background(), database.AttachMediaParams{
+			ChirpID:  chirp.ID,
+			Position: int32(i),
+			ID:       mediaID,
+			UserID:   chirp.UserID,
+		})
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return fmt.Errorf("%w: %s", errMediaUnavailable, mediaID)
+		}
+	}
+	return nil
+}
+
+// chirpsEmbedMedia fills in the media of the chirps and of the originals
+// embedded in them.
+func (cfg *apiConfig) chirpsEmbedMedia(chirpsResponse []Chirp) error {
+	chirps := chirpsByID(chirpsResponse)
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for id := range chirps {
+		chirpIDs = append(chirpIDs, id)
+	}
+	attachments, err := cfg.dbQueries.GetChirpsMedia(context.Background(), chirpIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		for _, chirp := range chirps[attachment.ChirpID.UUID] {
+			chirp.Media = append(chirp.Media, mediaFromDB(attachment))
+		}
+	}
+	return nil
+}
+
+// mediaDeleteBlobs removes blobs nothing refers to anymore. Failing to is
+// only logged, the worst outcome is an orphaned file.
+func (cfg *apiConfig) mediaDeleteBlobs(keys ...string) {
+	for _, key := range keys {
+		err := cfg.blobStore.Delete(context.Background(), key)
+		if err != nil {
+			log.Printf("Error deleting media %s: %s", key, err)
+		}
+	}
+}
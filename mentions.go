@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/el-damiano/bootdev-http-server/internal/chirptext"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// Mention is an @username in a chirp body resolved to the user. Start and End
+// are offsets in Unicode code points, End is exclusive.
+type Mention struct {
+	UserID uuid.UUID `json:"user_id"`
+	Start  int32     `json:"start"`
+	End    int32     `json:"end"`
+}
+
+// chirpSyncMentions replaces the mentions stored for a chirp with the ones in
+// its current body. Mentions of usernames nobody has are left as plain text.
+func chirpSyncMentions(qtx *database.Queries, chirp database.Chirp) error {
+	err := qtx.DeleteChirpMentions(context.Background(), chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	mentions := chirptext.Mentions(chirp.Body)
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	usernames := make([]string, 0, len(mentions))
+	for _, mention := range mentions {
+		usernames = append(usernames, strings.ToLower(mention.Username))
+	}
+	users, err := qtx.GetUsersByUsernames(context.Background(), usernames)
+	if err != nil {
+		return err
+	}
+	userIDs := make(map[string]uuid.UUID, len(users))
+	for _, user := range users {
+		userIDs[strings.ToLower(user.Username.String)] = user.ID
+	}
+
+	for _, mention := range mentions {
+		userID, ok := userIDs[strings.ToLower(mention.Username)]
+		if !ok {
+			continue
+		}
+		err = qtx.CreateChirpMention(context.Background(), database.CreateChirpMentionParams{
+			ChirpID:     chirp.ID,
+			UserID:      userID,
+			StartOffset: int32(mention.Start),
+			EndOffset:   int32(mention.End),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chirpsEmbedMentions fills in the mentions of the chirps and of the originals
+// embedded in them.
+func (cfg *apiConfig) chirpsEmbedMentions(chirpsResponse []Chirp) error {
+	chirps := chirpsByID(chirpsResponse)
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for id := range chirps {
+		chirpIDs = append(chirpIDs, id)
+	}
+	mentions, err := cfg.dbQueries.GetChirpMentions(context.Background(), chirpIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, mention := range mentions {
+		for _, chirp := range chirps[mention.ChirpID] {
+			chirp.Mentions = append(chirp.Mentions, Mention{
+				UserID: mention.UserID,
+				Start:  mention.StartOffset,
+				End:    mention.EndOffset,
+			})
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) mentionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	chirps, err := cfg.dbQueries.GetMentionsPage(context.Background(), database.GetMentionsPageParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the mentions", err)
+		return
+	}
+
+	chirps, nextCursor := pageTrim(chirps, page, chirpCursor)
+
+	chirpsResponse, err := cfg.chirpsResponse(chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the mentions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpsPage{
+		Chirps:     chirpsResponse,
+		NextCursor: nextCursor,
+	})
+}
@@ -0,0 +1,694 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// oauthCodeTTL is how long an authorization code works, the client trades it
+// for tokens right after the user is sent back.
+const oauthCodeTTL = 5 * time.Minute
+
+// scopeDescriptions tell users on the consent screen what a client asks for.
+var scopeDescriptions = map[auth.Scope]string{
+	auth.ScopeChirpsRead:   "Read posts, your timeline and your mentions",
+	auth.ScopeChirpsWrite:  "Post, edit and delete posts, like and rechirp for you",
+	auth.ScopeProfileWrite: "Update your profile and avatar, follow and unfollow for you",
+}
+
+// oauthError is an error of the OAuth endpoints, RFC 6749 section 5.2.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, err *oauthError) {
+	w.Header().Set("Cache-Control", "no-store")
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	respondWithJSON(w, code, err)
+}
+
+var errRedirectURIUnregistered = errors.New("redirect_uri isn't registered for the client")
+
+// authorizeRequest is a validated request of a client to be authorized.
+type authorizeRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	scopes        []auth.Scope
+	state         string
+	codeChallenge string
+}
+
+// oauthAuthorizeRequest validates the authorization request in the form.
+// Until the client and its redirect URI are known to be right, errors are
+// shown to the user, a made up redirect URI mustn't get the user sent
+// anywhere. After that they are *oauthError, for the client.
+func (cfg *apiConfig) oauthAuthorizeRequest(form url.Values) (authorizeRequest, error) {
+	client, err := cfg.oauthClient(form.Get("client_id"))
+	if err != nil {
+		return authorizeRequest{}, err
+	}
+
+	req := authorizeRequest{
+		client:        client,
+		redirectURI:   form.Get("redirect_uri"),
+		state:         form.Get("state"),
+		codeChallenge: form.Get("code_challenge"),
+	}
+	if req.redirectURI == "" && len(client.RedirectUris) == 1 {
+		req.redirectURI = client.RedirectUris[0]
+	}
+	if !slices.Contains(client.RedirectUris, req.redirectURI) {
+		return authorizeRequest{client: client}, errRedirectURIUnregistered
+	}
+
+	if form.Get("response_type") != "code" {
+		return req, &oauthError{Code: "unsupported_response_type", Description: "only the code response type is supported"}
+	}
+	if form.Get("code_challenge_method") != "S256" || !auth.ValidPKCEChallenge(req.codeChallenge) {
+		return req, &oauthError{Code: "invalid_request", Description: "PKCE with an S256 code_challenge is required"}
+	}
+
+	req.scopes, err = auth.ParseScopes(strings.Fields(form.Get("scope")))
+	if err != nil {
+		return req, &oauthError{Code: "invalid_scope", Description: err.Error()}
+	}
+	if len(req.scopes) == 0 {
+		req.scopes, _ = auth.ParseScopes(client.Scopes)
+	}
+	for _, scope := range req.scopes {
+		if !slices.Contains(client.Scopes, string(scope)) {
+			return req, &oauthError{Code: "invalid_scope", Description: fmt.Sprintf("the client isn't allowed the %s scope", scope)}
+		}
+	}
+	return req, nil
+}
+
+// redirect sends the user back to the client with the values, like the code.
+func (req authorizeRequest) redirect(w http.ResponseWriter, r *http.Request, values url.Values) {
+	target, err := url.Parse(req.redirectURI)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error redirecting to the client", err)
+		return
+	}
+	query := target.Query()
+	for name := range values {
+		query.Set(name, values.Get(name))
+	}
+	if req.state != "" {
+		query.Set("state", req.state)
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (req authorizeRequest) redirectError(w http.ResponseWriter, r *http.Request, err *oauthError) {
+	req.redirect(w, r, url.Values{"error": {err.Code}, "error_description": {err.Description}})
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <title>{{if .Client}}Authorize {{.Client}} - {{end}}Chirpy</title>
+  </head>
+  <body>
+    {{if .Scopes}}
+    <h1>{{.Client}} wants to use your Chirpy account</h1>
+    <p>Log in to let it:</p>
+    <ul>
+      {{range .Scopes}}<li>{{.}}</li>
+      {{end}}
+    </ul>
+    {{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+    <form method="post" action="/oauth/authorize">
+      {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+      {{end}}
+      <p><label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username"></label></p>
+      <p><label>Password <input type="password" name="password" autocomplete="current-password"></label></p>
+      <p><label>Two-factor code, if you enabled it <input name="code" inputmode="numeric" autocomplete="one-time-code"></label></p>
+      <p><label>Or a recovery code <input name="recovery_code" autocomplete="off"></label></p>
+      <p>
+        <button type="submit" name="decision" value="allow">Allow</button>
+        <button type="submit" name="decision" value="deny">Deny</button>
+      </p>
+    </form>
+    <p>You will be sent back to {{.RedirectURI}}. You can take the access back any time by logging out its session.</p>
+    {{else}}
+    <h1>Can't authorize the app</h1>
+    <p role="alert">{{.Error}}</p>
+    {{end}}
+  </body>
+</html>
+`))
+
+type consentPage struct {
+	Client      string
+	Scopes      []string
+	Params      map[string]string
+	RedirectURI string
+	Email       string
+	Error       string
+}
+
+// respondWithConsent shows the consent screen, or just the error without
+// any scopes.
+func respondWithConsent(w http.ResponseWriter, code int, page consentPage) {
+	// only ever shown on its own, never framed by a page tricking the user
+	// into clicking Allow
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	err := consentTemplate.Execute(w, page)
+	if err != nil {
+		log.Printf("Error writing the consent screen: %s", err)
+	}
+}
+
+func (req authorizeRequest) consentPage(email, errorMessage string) consentPage {
+	page := consentPage{
+		Client: req.client.Name,
+		Params: map[string]string{
+			"response_type":         "code",
+			"client_id":             req.client.ID.String(),
+			"redirect_uri":          req.redirectURI,
+			"scope":                 auth.ScopeString(req.scopes),
+			"state":                 req.state,
+			"code_challenge":        req.codeChallenge,
+			"code_challenge_method": "S256",
+		},
+		RedirectURI: req.redirectURI,
+		Email:       email,
+		Error:       errorMessage,
+	}
+	for _, scope := range req.scopes {
+		page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+	}
+	return page
+}
+
+// authorizeRequestOK shows the user why the request can't be authorized
+// when it's the client or its redirect URI that's wrong.
+func authorizeRequestOK(w http.ResponseWriter, req authorizeRequest, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errOAuthClientInvalid):
+		respondWithConsent(w, http.StatusBadRequest, consentPage{Error: "The app asking isn't registered with Chirpy."})
+	case errors.Is(err, errRedirectURIUnregistered):
+		respondWithConsent(w, http.StatusBadRequest, consentPage{Client: req.client.Name, Error: "The app asked to send you to a page it didn't register."})
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Error authorizing the app", err)
+	}
+	return false
+}
+
+// oauthAuthorizeHandler shows the consent screen of an authorization
+// request, RFC 6749 section 4.1.1. Only the code flow with PKCE is
+// supported.
+func (cfg *apiConfig) oauthAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := cfg.oauthAuthorizeRequest(r.URL.Query())
+	oauthErr := &oauthError{}
+	if errors.As(err, &oauthErr) {
+		req.redirectError(w, r, oauthErr)
+		return
+	}
+	if !authorizeRequestOK(w, req, err) {
+		return
+	}
+
+	respondWithConsent(w, http.StatusOK, req.consentPage("", ""))
+}
+
+// oauthConsentHandler logs in the user on the consent screen and, if they
+// allow it, sends them back to the client with an authorization code. The
+// login is throttled like any other, and takes the two-factor code as well
+// when it's enabled.
+func (cfg *apiConfig) oauthConsentHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		respondWithConsent(w, http.StatusBadRequest, consentPage{Error: "The form couldn't be read, go back to the app and try again."})
+		return
+	}
+
+	req, err := cfg.oauthAuthorizeRequest(r.PostForm)
+	oauthErr := &oauthError{}
+	if errors.As(err, &oauthErr) {
+		req.redirectError(w, r, oauthErr)
+		return
+	}
+	if !authorizeRequestOK(w, req, err) {
+		return
+	}
+
+	if r.PostFormValue("decision") != "allow" {
+		req.redirectError(w, r, &oauthError{Code: "access_denied", Description: "the user denied access"})
+		return
+	}
+
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	password := r.PostFormValue("password")
+	code := strings.TrimSpace(r.PostFormValue("code"))
+	recoveryCode := strings.TrimSpace(r.PostFormValue("recovery_code"))
+
+	wait, err := cfg.loginAttempt(r, email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondWithConsent(w, http.StatusTooManyRequests, req.consentPage(email, "Too many failed logins, try again later."))
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		cfg.loginFailed(r, email, nil)
+		respondWithConsent(w, http.StatusUnauthorized, req.consentPage(email, "Incorrect email or password."))
+		return
+	}
+	rehash, err := cfg.passwords.Check(password, user.HashedPassword)
+	if err != nil {
+		cfg.loginFailed(r, email, &user)
+		respondWithConsent(w, http.StatusUnauthorized, req.consentPage(email, "Incorrect email or password."))
+		return
+	}
+	if rehash {
+		cfg.userPasswordRehash(user, password)
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error authorizing the app", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	if user.TotpEnabledAt.Valid {
+		if code == "" && recoveryCode == "" {
+			cfg.loginPasswordCorrect(r, email)
+			respondWithConsent(w, http.StatusUnauthorized, req.consentPage(email, "Enter the code from your authenticator app, or a recovery code."))
+			return
+		}
+		err = cfg.mfaCheck(qtx, user, code, recoveryCode)
+		if errors.Is(err, errMFAInvalid) {
+			cfg.loginFailed(r, email, &user)
+			respondWithConsent(w, http.StatusUnauthorized, req.consentPage(email, "Incorrect two-factor authentication code."))
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+			return
+		}
+	}
+
+	authorizationCode, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error authorizing the app", err)
+		return
+	}
+	scopes := auth.ScopeString(req.scopes)
+	err = qtx.CreateOAuthAuthorizationCode(context.Background(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(authorizationCode),
+		ClientID:      req.client.ID,
+		UserID:        user.ID,
+		RedirectUri:   req.redirectURI,
+		Scopes:        strings.Fields(scopes),
+		CodeChallenge: req.codeChallenge,
+		ExpiresAt:     cfg.now().UTC().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error authorizing the app", err)
+		return
+	}
+	err = securityEventLog(qtx, user.ID, securityEventOAuthAuthorized,
+		fmt.Sprintf("authorized client %s (%s) for %s", req.client.Name, req.client.ID, scopes))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error authorizing the app", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error authorizing the app", err)
+		return
+	}
+	cfg.loginSucceeded(r, user.Email)
+
+	req.redirect(w, r, url.Values{"code": {authorizationCode}})
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// oauthTokenHandler trades an authorization code, or a refresh token, for an
+// access token limited to the scopes the user allowed and a refresh token,
+// RFC 6749 sections 4.1.3 and 6.
+func (cfg *apiConfig) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := cfg.oauthClientAuthenticate(r)
+	if errors.Is(err, errOAuthClientInvalid) {
+		respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{Code: "invalid_client", Description: err.Error()})
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error issuing tokens", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error issuing tokens", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	var response oauthTokenResponse
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		response, err = cfg.oauthCodeExchange(qtx, r, client)
+	case "refresh_token":
+		response, err = cfg.oauthRefresh(qtx, r, client)
+	default:
+		err = &oauthError{Code: "unsupported_grant_type", Description: "grant_type must be authorization_code or refresh_token"}
+	}
+
+	// failures may have revoked tokens or spent the code, that has to stick
+	oauthErr := &oauthError{}
+	if err == nil || errors.As(err, &oauthErr) {
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error issuing tokens", commitErr)
+			return
+		}
+	}
+	if errors.As(err, &oauthErr) {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErr)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error issuing tokens", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// oauthCodeExchange spends an authorization code, starting the session the
+// client's tokens belong to. A code used twice means it leaked, so the
+// tokens issued for it are revoked.
+func (cfg *apiConfig) oauthCodeExchange(qtx *database.Queries, r *http.Request, client database.OauthClient) (oauthTokenResponse, error) {
+	invalidGrant := &oauthError{Code: "invalid_grant", Description: "the code is invalid, expired or already used"}
+
+	code, err := qtx.GetOAuthAuthorizationCodeForUpdate(context.Background(), auth.HashToken(r.PostFormValue("code")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauthTokenResponse{}, invalidGrant
+	}
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	if code.ClientID != client.ID {
+		return oauthTokenResponse{}, invalidGrant
+	}
+
+	if code.UsedAt.Valid {
+		err = qtx.RevokeRefreshTokenFamily(context.Background(), code.FamilyID)
+		if err != nil {
+			return oauthTokenResponse{}, err
+		}
+		err = securityEventLog(qtx, code.UserID, securityEventOAuthCodeReuse,
+			fmt.Sprintf("authorization code of client %s used at %s was used again, revoked token family %s",
+				client.ID, code.UsedAt.Time.Format(time.RFC3339), code.FamilyID))
+		if err != nil {
+			return oauthTokenResponse{}, err
+		}
+		return oauthTokenResponse{}, invalidGrant
+	}
+
+	// spent whether the rest checks out or not, codes get one try
+	err = qtx.UseOAuthAuthorizationCode(context.Background(), code.CodeHash)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	if !code.ExpiresAt.After(cfg.now().UTC()) {
+		return oauthTokenResponse{}, invalidGrant
+	}
+	if r.PostFormValue("redirect_uri") != code.RedirectUri {
+		return oauthTokenResponse{}, &oauthError{Code: "invalid_grant", Description: "redirect_uri doesn't match the one the code was sent to"}
+	}
+	if !auth.CheckPKCE(r.PostFormValue("code_verifier"), code.CodeChallenge) {
+		return oauthTokenResponse{}, &oauthError{Code: "invalid_grant", Description: "code_verifier doesn't match the code_challenge"}
+	}
+
+	scopes, err := auth.ParseScopes(code.Scopes)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	return cfg.oauthTokensIssue(qtx, r, client, code.UserID, code.FamilyID, cfg.now().UTC(), code.Scopes, scopes)
+}
+
+// oauthRefresh rotates a refresh token of the client like logins do. The
+// access token can be limited to fewer scopes than the user allowed, the
+// session keeps them all.
+func (cfg *apiConfig) oauthRefresh(qtx *database.Queries, r *http.Request, client database.OauthClient) (oauthTokenResponse, error) {
+	tokenOld, err := cfg.refreshTokenRotate(qtx, r.PostFormValue("refresh_token"), uuid.NullUUID{UUID: client.ID, Valid: true})
+	if errors.Is(err, errRefreshTokenInvalid) || errors.Is(err, errRefreshTokenReused) {
+		return oauthTokenResponse{}, &oauthError{Code: "invalid_grant", Description: err.Error()}
+	}
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+
+	scopes, err := auth.ParseScopes(tokenOld.Scopes)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	if requested := strings.Fields(r.PostFormValue("scope")); len(requested) > 0 {
+		narrower, err := auth.ParseScopes(requested)
+		if err != nil {
+			return oauthTokenResponse{}, &oauthError{Code: "invalid_scope", Description: err.Error()}
+		}
+		for _, scope := range narrower {
+			if !slices.Contains(scopes, scope) {
+				return oauthTokenResponse{}, &oauthError{Code: "invalid_scope", Description: fmt.Sprintf("the %s scope wasn't allowed by the user", scope)}
+			}
+		}
+		scopes = narrower
+	}
+	return cfg.oauthTokensIssue(qtx, r, client, tokenOld.UserID, tokenOld.FamilyID, tokenOld.FamilyCreatedAt, tokenOld.Scopes, scopes)
+}
+
+// oauthTokensIssue makes the next refresh token of the session, keeping the
+// scopes the user allowed, and an access token limited to scopes.
+func (cfg *apiConfig) oauthTokensIssue(qtx *database.Queries, r *http.Request, client database.OauthClient, userID, sessionID uuid.UUID, sessionCreatedAt time.Time, allowed []string, scopes []auth.Scope) (oauthTokenResponse, error) {
+	refreshToken, err := cfg.clientRefreshTokenCreate(qtx, r, userID, sessionID, sessionCreatedAt, uuid.NullUUID{UUID: client.ID, Valid: true}, allowed)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	accessToken, err := cfg.keyRing.MakeClientJWT(userID, sessionID, client.ID.String(), scopes, accessTokenTTL)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	return oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.ScopeString(scopes),
+	}, nil
+}
+
+// oauthTokenInfo is what introspection tells about an active token, RFC 7662
+// section 2.2.
+type oauthTokenInfo struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// oauthIntrospectHandler tells whether an access or refresh token is active
+// and what it may do, RFC 7662. Admins can ask about any token, confidential
+// clients only about their own. Access tokens of logged out sessions are
+// inactive, though those of the user's own logins keep working with the API
+// until they expire.
+func (cfg *apiConfig) oauthIntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	callerClientID := ""
+	if cfg.authorizeAdmin(r) != nil {
+		client, err := cfg.oauthClientAuthenticate(r)
+		if err == nil && !client.SecretHash.Valid {
+			err = errors.New("public clients can't introspect tokens")
+		}
+		if err != nil {
+			respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{Code: "invalid_client", Description: err.Error()})
+			return
+		}
+		callerClientID = client.ID.String()
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{Code: "invalid_request", Description: "token is required"})
+		return
+	}
+
+	info, err := cfg.oauthTokenInspect(token, r.PostFormValue("token_type_hint"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error introspecting the token", err)
+		return
+	}
+	if callerClientID != "" && info.ClientID != callerClientID {
+		info = oauthTokenInfo{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, info)
+}
+
+// oauthTokenInspect tells about an access or a refresh token, trying the
+// hinted kind first.
+func (cfg *apiConfig) oauthTokenInspect(token, hint string) (oauthTokenInfo, error) {
+	if hint == "refresh_token" {
+		info, err := cfg.oauthRefreshTokenInspect(token)
+		if err != nil || info.Active {
+			return info, err
+		}
+		return cfg.oauthAccessTokenInspect(token)
+	}
+
+	info, err := cfg.oauthAccessTokenInspect(token)
+	if err != nil || info.Active {
+		return info, err
+	}
+	return cfg.oauthRefreshTokenInspect(token)
+}
+
+func (cfg *apiConfig) oauthAccessTokenInspect(token string) (oauthTokenInfo, error) {
+	accessToken, err := cfg.keyRing.ParseJWT(token)
+	if err != nil {
+		return oauthTokenInfo{}, nil
+	}
+	if accessToken.SessionID != uuid.Nil {
+		active, err := cfg.sessionActive(accessToken.SessionID)
+		if err != nil {
+			return oauthTokenInfo{}, err
+		}
+		if !active {
+			return oauthTokenInfo{}, nil
+		}
+	}
+
+	return oauthTokenInfo{
+		Active:    true,
+		Scope:     auth.ScopeString(accessToken.Scopes),
+		ClientID:  accessToken.ClientID,
+		TokenType: "Bearer",
+		Subject:   accessToken.UserID.String(),
+		ExpiresAt: accessToken.ExpiresAt.Unix(),
+		IssuedAt:  accessToken.IssuedAt.Unix(),
+	}, nil
+}
+
+func (cfg *apiConfig) oauthRefreshTokenInspect(token string) (oauthTokenInfo, error) {
+	refreshToken, err := cfg.dbQueries.GetRefreshToken(context.Background(), auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauthTokenInfo{}, nil
+	}
+	if err != nil {
+		return oauthTokenInfo{}, err
+	}
+	if refreshToken.RevokedAt.Valid || !refreshToken.ExpiresAt.After(cfg.now().UTC()) {
+		return oauthTokenInfo{}, nil
+	}
+
+	info := oauthTokenInfo{
+		Active:    true,
+		Scope:     strings.Join(refreshToken.Scopes, " "),
+		Subject:   refreshToken.UserID.String(),
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+	}
+	if refreshToken.ClientID.Valid {
+		info.ClientID = refreshToken.ClientID.UUID.String()
+	}
+	return info, nil
+}
+
+// oauthRevokeHandler revokes a token of the client, RFC 7009, logging out
+// the whole session it belongs to, its access tokens stop working with it.
+// Unknown tokens succeed all the same, they don't work either way.
+func (cfg *apiConfig) oauthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := cfg.oauthClientAuthenticate(r)
+	if errors.Is(err, errOAuthClientInvalid) {
+		respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{Code: "invalid_client", Description: err.Error()})
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking the token", err)
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{Code: "invalid_request", Description: "token is required"})
+		return
+	}
+
+	sessionID := uuid.Nil
+	refreshToken, err := cfg.dbQueries.GetRefreshToken(context.Background(), auth.HashToken(token))
+	if err == nil && refreshToken.ClientID.Valid && refreshToken.ClientID.UUID == client.ID {
+		sessionID = refreshToken.FamilyID
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking the token", err)
+		return
+	}
+	if accessToken, err := cfg.keyRing.ParseJWT(token); err == nil && accessToken.ClientID == client.ID.String() {
+		sessionID = accessToken.SessionID
+	}
+
+	if sessionID != uuid.Nil {
+		err = cfg.dbQueries.RevokeRefreshTokenFamily(context.Background(), sessionID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error revoking the token", err)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const oauthClientNameLenMax = 64
+
+// OAuthClient is a third-party app users can let act for them. Confidential
+// clients, run on a server, authenticate with their ClientSecret, which is
+// only ever returned when the client is registered. Public ones, like mobile
+// apps, can't keep a secret and rely on PKCE alone.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func oauthClientFromDB(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// redirectURIParam validates a redirect URI of a client. Codes are only ever
+// sent to https URIs, http ones on the client's own machine, or the
+// reverse domain name schemes of native apps, like com.example.app:/done.
+func redirectURIParam(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || !parsed.IsAbs() {
+		return fmt.Errorf("redirect URI %q must be an absolute URI", uri)
+	}
+	if parsed.Fragment != "" || parsed.User != nil {
+		return fmt.Errorf("redirect URI %q can't have a fragment or user info", uri)
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		if parsed.Host == "" {
+			return fmt.Errorf("redirect URI %q must have a host", uri)
+		}
+	case "http":
+		switch parsed.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+		default:
+			return fmt.Errorf("redirect URI %q must use https, http is only for localhost", uri)
+		}
+	default:
+		if !strings.Contains(parsed.Scheme, ".") {
+			return fmt.Errorf("redirect URI %q must use https or a reverse domain name scheme like com.example.app", uri)
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) oauthClientCreateHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	errs := validationErrors{}
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		errs.add("name", errors.New("name is required"))
+	} else if utf8.RuneCountInString(name) > oauthClientNameLenMax {
+		errs.add("name", fmt.Errorf("name must be at most %d characters long", oauthClientNameLenMax))
+	}
+	if len(params.RedirectURIs) == 0 {
+		errs.add("redirect_uris", errors.New("redirect_uris are required"))
+	}
+	for _, uri := range params.RedirectURIs {
+		errs.add("redirect_uris", redirectURIParam(uri))
+	}
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err == nil && len(scopes) == 0 {
+		err = errors.New("scopes are required")
+	}
+	errs.add("scopes", err)
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error registering client", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	scopeNames := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scopeNames = append(scopeNames, string(scope))
+	}
+	client, err := cfg.dbQueries.CreateOAuthClient(context.Background(), database.CreateOAuthClientParams{
+		Name:         name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       scopeNames,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error registering client", err)
+		return
+	}
+
+	response := oauthClientFromDB(client)
+	response.ClientSecret = secret
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) oauthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetOAuthClients(context.Background())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving clients", err)
+		return
+	}
+
+	clients := make([]OAuthClient, 0, len(rows))
+	for _, row := range rows {
+		clients = append(clients, oauthClientFromDB(row))
+	}
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+// oauthClientDeleteHandler removes a client along with every session users
+// authorized it for.
+func (cfg *apiConfig) oauthClientDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	deleted, err := cfg.dbQueries.DeleteOAuthClient(context.Background(), clientID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting client", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Client not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var errOAuthClientInvalid = errors.New("unknown client or wrong client secret")
+
+// oauthClient looks up a client by the ID it gave.
+func (cfg *apiConfig) oauthClient(clientID string) (database.OauthClient, error) {
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return database.OauthClient{}, errOAuthClientInvalid
+	}
+	client, err := cfg.dbQueries.GetOAuthClient(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, errOAuthClientInvalid
+	}
+	return client, err
+}
+
+// oauthClientAuthenticate identifies the client calling the token endpoints
+// by HTTP Basic authentication or the client_id and client_secret form
+// values. Confidential clients have to give their secret, public ones only
+// their ID.
+func (cfg *apiConfig) oauthClientAuthenticate(r *http.Request) (database.OauthClient, error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 form encodes both before joining them
+		var err error
+		clientID, err = url.QueryUnescape(clientID)
+		if err != nil {
+			return database.OauthClient{}, errOAuthClientInvalid
+		}
+		secret, err = url.QueryUnescape(secret)
+		if err != nil {
+			return database.OauthClient{}, errOAuthClientInvalid
+		}
+	} else {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	client, err := cfg.oauthClient(clientID)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	if client.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, errOAuthClientInvalid
+		}
+	} else if secret != "" {
+		return database.OauthClient{}, errOAuthClientInvalid
+	}
+	return client, nil
+}
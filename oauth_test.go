@@ -0,0 +1,466 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "otters-hold-hands-while-they-sleep-so-they-dont-drift-apart"
+)
+
+// oauthClientCreate registers a client allowed chirps:read and chirps:write.
+func (api *testAPI) oauthClientCreate(t *testing.T, confidential bool) OAuthClient {
+	t.Helper()
+	res := api.request(t, "POST", "/admin/oauth/clients", "ApiKey "+testAdminKey, map[string]any{
+		"name":          "Weather bot",
+		"redirect_uris": []string{testRedirectURI},
+		"scopes":        []auth.Scope{auth.ScopeChirpsRead, auth.ScopeChirpsWrite},
+		"confidential":  confidential,
+	})
+	if res.code != http.StatusCreated {
+		t.Fatalf("Error registering client: %d %s", res.code, res.body)
+	}
+	client := OAuthClient{}
+	res.decode(t, &client)
+	return client
+}
+
+// authorizeForm is the request of the client for chirps:read, with the
+// answer of the user allowing it on the consent screen.
+func authorizeForm(client OAuthClient, email string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID.String()},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {string(auth.ScopeChirpsRead)},
+		"state":                 {"xyz"},
+		"code_challenge":        {auth.PKCEChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+		"email":                 {email},
+		"password":              {testPassword},
+		"decision":              {"allow"},
+	}
+}
+
+// redirectQuery returns the query the user is sent back to the client with.
+func redirectQuery(t *testing.T, res testResponse) url.Values {
+	t.Helper()
+	if res.code != http.StatusFound {
+		t.Fatalf("got %d %s, want a redirect with %d", res.code, res.body, http.StatusFound)
+	}
+	location, err := url.Parse(res.header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := location.Query()
+	location.RawQuery = ""
+	if location.String() != testRedirectURI {
+		t.Fatalf("redirected to %s, want %s", location, testRedirectURI)
+	}
+	if query.Get("state") != "xyz" {
+		t.Errorf("redirected with state %q, want it back as is", query.Get("state"))
+	}
+	return query
+}
+
+// oauthAuthorize lets the client act for the user, returning its code.
+func (api *testAPI) oauthAuthorize(t *testing.T, client OAuthClient, email string) string {
+	t.Helper()
+	res := api.request(t, "POST", "/oauth/authorize", "", authorizeForm(client, email))
+	code := redirectQuery(t, res).Get("code")
+	if code == "" {
+		t.Fatalf("redirected with %s, want a code", res.header.Get("Location"))
+	}
+	return code
+}
+
+// tokenForm trades the code for tokens with the verifier of authorizeForm.
+func tokenForm(client OAuthClient, code string) url.Values {
+	return url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+		"client_id":     {client.ID.String()},
+		"client_secret": {client.ClientSecret},
+	}
+}
+
+func (api *testAPI) oauthTokens(t *testing.T, client OAuthClient, code string) oauthTokenResponse {
+	t.Helper()
+	res := api.request(t, "POST", "/oauth/token", "", tokenForm(client, code))
+	if res.code != http.StatusOK {
+		t.Fatalf("POST /oauth/token got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+	tokens := oauthTokenResponse{}
+	res.decode(t, &tokens)
+	return tokens
+}
+
+// oauthActive tells whether introspection finds the token active.
+func (api *testAPI) oauthActive(t *testing.T, token string) bool {
+	t.Helper()
+	res := api.request(t, "POST", "/oauth/introspect", "ApiKey "+testAdminKey, url.Values{"token": {token}})
+	if res.code != http.StatusOK {
+		t.Fatalf("POST /oauth/introspect got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+	info := oauthTokenInfo{}
+	res.decode(t, &info)
+	return info.Active
+}
+
+func TestOAuthAuthorizeHandler(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	client := api.oauthClientCreate(t, true)
+
+	cases := map[string]struct {
+		// set replaces values of the request, "" removes them
+		set       map[string]string
+		wantCode  int
+		wantError string
+	}{
+		"consent screen": {
+			wantCode: http.StatusOK,
+		},
+		"all the client's scopes": {
+			set:      map[string]string{"scope": ""},
+			wantCode: http.StatusOK,
+		},
+		"no PKCE": {
+			set:       map[string]string{"code_challenge": "", "code_challenge_method": ""},
+			wantCode:  http.StatusFound,
+			wantError: "invalid_request",
+		},
+		"plain PKCE": {
+			set:       map[string]string{"code_challenge": testCodeVerifier, "code_challenge_method": "plain"},
+			wantCode:  http.StatusFound,
+			wantError: "invalid_request",
+		},
+		"implicit flow": {
+			set:       map[string]string{"response_type": "token"},
+			wantCode:  http.StatusFound,
+			wantError: "unsupported_response_type",
+		},
+		"unknown scope": {
+			set:       map[string]string{"scope": "chirps:read chirps:delete"},
+			wantCode:  http.StatusFound,
+			wantError: "invalid_scope",
+		},
+		"scope the client isn't allowed": {
+			set:       map[string]string{"scope": string(auth.ScopeProfileWrite)},
+			wantCode:  http.StatusFound,
+			wantError: "invalid_scope",
+		},
+		"unknown client": {
+			set:      map[string]string{"client_id": uuid.NewString()},
+			wantCode: http.StatusBadRequest,
+		},
+		"unregistered redirect URI": {
+			set:      map[string]string{"redirect_uri": "https://evil.example.com/callback"},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			query := authorizeForm(client, "")
+			for _, name := range []string{"email", "password", "decision"} {
+				query.Del(name)
+			}
+			for name, value := range c.set {
+				query.Set(name, value)
+				if value == "" {
+					query.Del(name)
+				}
+			}
+
+			res := api.request(t, "GET", "/oauth/authorize?"+query.Encode(), "", nil)
+			if res.code != c.wantCode {
+				t.Fatalf("GET /oauth/authorize got %d %s, want %d", res.code, res.body, c.wantCode)
+			}
+			if res.code == http.StatusFound {
+				if got := redirectQuery(t, res).Get("error"); got != c.wantError {
+					t.Errorf("GET /oauth/authorize redirected with error %q, want %q", got, c.wantError)
+				}
+			}
+			if res.code == http.StatusOK && !strings.Contains(string(res.body), client.Name) {
+				t.Errorf("GET /oauth/authorize got %s, want the consent screen of %s", res.body, client.Name)
+			}
+		})
+	}
+}
+
+func TestOAuthTokenHandler(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	email := api.userCreate(t)
+	client := api.oauthClientCreate(t, true)
+	clientPublic := api.oauthClientCreate(t, false)
+	clientOther := api.oauthClientCreate(t, true)
+
+	cases := map[string]struct {
+		client OAuthClient
+		// set replaces values of the form trading the code
+		set       map[string]string
+		wait      time.Duration
+		wantCode  int
+		wantError string
+	}{
+		"code": {
+			client:   client,
+			wantCode: http.StatusOK,
+		},
+		"code of a public client": {
+			client:   clientPublic,
+			wantCode: http.StatusOK,
+		},
+		"wrong code verifier": {
+			client:    client,
+			set:       map[string]string{"code_verifier": strings.Repeat("a", 43)},
+			wantCode:  http.StatusBadRequest,
+			wantError: "invalid_grant",
+		},
+		"no code verifier": {
+			client:    clientPublic,
+			set:       map[string]string{"code_verifier": ""},
+			wantCode:  http.StatusBadRequest,
+			wantError: "invalid_grant",
+		},
+		"wrong redirect URI": {
+			client:    client,
+			set:       map[string]string{"redirect_uri": "https://app.example.com/elsewhere"},
+			wantCode:  http.StatusBadRequest,
+			wantError: "invalid_grant",
+		},
+		"expired code": {
+			client:    client,
+			wait:      oauthCodeTTL,
+			wantCode:  http.StatusBadRequest,
+			wantError: "invalid_grant",
+		},
+		"code of another client": {
+			client:    client,
+			set:       map[string]string{"client_id": clientOther.ID.String(), "client_secret": clientOther.ClientSecret},
+			wantCode:  http.StatusBadRequest,
+			wantError: "invalid_grant",
+		},
+		"wrong client secret": {
+			client:    client,
+			set:       map[string]string{"client_secret": "otter"},
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_client",
+		},
+		"unsupported grant type": {
+			client:    client,
+			set:       map[string]string{"grant_type": "password"},
+			wantCode:  http.StatusBadRequest,
+			wantError: "unsupported_grant_type",
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			form := tokenForm(c.client, api.oauthAuthorize(t, c.client, email))
+			for name, value := range c.set {
+				form.Set(name, value)
+			}
+			api.clock.Add(c.wait)
+
+			res := api.request(t, "POST", "/oauth/token", "", form)
+			if res.code != c.wantCode {
+				t.Fatalf("POST /oauth/token got %d %s, want %d", res.code, res.body, c.wantCode)
+			}
+			if c.wantError != "" {
+				oauthErr := oauthError{}
+				res.decode(t, &oauthErr)
+				if oauthErr.Code != c.wantError {
+					t.Errorf("POST /oauth/token got error %q, want %q", oauthErr.Code, c.wantError)
+				}
+				return
+			}
+
+			tokens := oauthTokenResponse{}
+			res.decode(t, &tokens)
+			if tokens.TokenType != "Bearer" || tokens.Scope != string(auth.ScopeChirpsRead) || tokens.RefreshToken == "" {
+				t.Errorf("POST /oauth/token got %+v, want Bearer tokens for chirps:read", tokens)
+			}
+			// only what the user allowed
+			res = api.request(t, "GET", "/api/chirps", bearer(tokens.AccessToken), nil)
+			if res.code != http.StatusOK {
+				t.Errorf("GET /api/chirps got %d %s, want %d", res.code, res.body, http.StatusOK)
+			}
+			res = api.request(t, "POST", "/api/chirps", bearer(tokens.AccessToken), map[string]string{"body": "Sunny all week"})
+			if res.code != http.StatusForbidden {
+				t.Errorf("POST /api/chirps got %d %s, want %d", res.code, res.body, http.StatusForbidden)
+			}
+			res = api.request(t, "GET", "/api/sessions", bearer(tokens.AccessToken), nil)
+			if res.code != http.StatusUnauthorized {
+				t.Errorf("GET /api/sessions got %d, want the app turned away with %d", res.code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestOAuthRevocation(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	email := api.userCreate(t)
+
+	cases := map[string]struct {
+		revoke func(t *testing.T, client OAuthClient, code string, tokens oauthTokenResponse)
+	}{
+		"code used twice": {
+			revoke: func(t *testing.T, client OAuthClient, code string, tokens oauthTokenResponse) {
+				res := api.request(t, "POST", "/oauth/token", "", tokenForm(client, code))
+				if res.code != http.StatusBadRequest {
+					t.Fatalf("POST /oauth/token reusing the code got %d %s, want %d", res.code, res.body, http.StatusBadRequest)
+				}
+			},
+		},
+		"refresh token revoked by the app": {
+			revoke: func(t *testing.T, client OAuthClient, code string, tokens oauthTokenResponse) {
+				form := url.Values{"token": {tokens.RefreshToken}, "client_id": {client.ID.String()}, "client_secret": {client.ClientSecret}}
+				res := api.request(t, "POST", "/oauth/revoke", "", form)
+				if res.code != http.StatusOK {
+					t.Fatalf("POST /oauth/revoke got %d %s, want %d", res.code, res.body, http.StatusOK)
+				}
+			},
+		},
+		"access token revoked by the app": {
+			revoke: func(t *testing.T, client OAuthClient, code string, tokens oauthTokenResponse) {
+				form := url.Values{"token": {tokens.AccessToken}, "client_id": {client.ID.String()}, "client_secret": {client.ClientSecret}}
+				res := api.request(t, "POST", "/oauth/revoke", "", form)
+				if res.code != http.StatusOK {
+					t.Fatalf("POST /oauth/revoke got %d %s, want %d", res.code, res.body, http.StatusOK)
+				}
+			},
+		},
+		"client deleted": {
+			revoke: func(t *testing.T, client OAuthClient, code string, tokens oauthTokenResponse) {
+				res := api.request(t, "DELETE", "/admin/oauth/clients/"+client.ID.String(), "ApiKey "+testAdminKey, nil)
+				if res.code != http.StatusNoContent {
+					t.Fatalf("DELETE /admin/oauth/clients/%s got %d %s, want %d", client.ID, res.code, res.body, http.StatusNoContent)
+				}
+			},
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			client := api.oauthClientCreate(t, true)
+			code := api.oauthAuthorize(t, client, email)
+			tokens := api.oauthTokens(t, client, code)
+			if !api.oauthActive(t, tokens.AccessToken) {
+				t.Fatalf("POST /oauth/introspect found a new access token inactive")
+			}
+
+			c.revoke(t, client, code, tokens)
+
+			res := api.request(t, "GET", "/api/chirps", bearer(tokens.AccessToken), nil)
+			if res.code != http.StatusUnauthorized {
+				t.Errorf("GET /api/chirps with a revoked access token got %d, want %d", res.code, http.StatusUnauthorized)
+			}
+			if api.oauthActive(t, tokens.AccessToken) || api.oauthActive(t, tokens.RefreshToken) {
+				t.Errorf("POST /oauth/introspect found revoked tokens active")
+			}
+			form := url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {tokens.RefreshToken},
+				"client_id":     {client.ID.String()},
+				"client_secret": {client.ClientSecret},
+			}
+			res = api.request(t, "POST", "/oauth/token", "", form)
+			if res.code == http.StatusOK {
+				t.Errorf("POST /oauth/token refreshed a revoked session")
+			}
+		})
+	}
+
+	user := api.login(t, email, testPassword)
+	if got := api.securityEvents(t, user.ID, securityEventOAuthCodeReuse); got != 1 {
+		t.Errorf("got %d %s security events, want 1", got, securityEventOAuthCodeReuse)
+	}
+}
+
+func TestOAuthConsentTwoFactor(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	email := api.userCreate(t)
+	user := api.login(t, email, testPassword)
+	client := api.oauthClientCreate(t, true)
+
+	secret, recoveryCodes := api.totpEnable(t, user)
+	appCode := func() string { return api.totpCode(t, secret) }
+
+	cases := map[string]struct {
+		// values returns the codes to fill in the consent form with
+		values   func() url.Values
+		wantCode int
+	}{
+		"no code": {
+			values:   func() url.Values { return url.Values{} },
+			wantCode: http.StatusUnauthorized,
+		},
+		"app code": {
+			values:   func() url.Values { return url.Values{"code": {appCode()}} },
+			wantCode: http.StatusFound,
+		},
+		"app code pasted with a space": {
+			values: func() url.Values {
+				code := appCode()
+				return url.Values{"code": {" " + code[:3] + " " + code[3:] + " "}}
+			},
+			wantCode: http.StatusFound,
+		},
+		"wrong app code": {
+			values: func() url.Values {
+				code := appCode()
+				return url.Values{"code": {fmt.Sprint((code[0]-'0'+1)%10) + code[1:]}}
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		"recovery code": {
+			values:   func() url.Values { return url.Values{"recovery_code": {recoveryCodes[0]}} },
+			wantCode: http.StatusFound,
+		},
+		"recovery code typed loosely": {
+			values: func() url.Values {
+				return url.Values{"recovery_code": {" " + strings.ToUpper(strings.ReplaceAll(recoveryCodes[1], "-", " ")) + " "}}
+			},
+			wantCode: http.StatusFound,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			// a code of the app works once
+			api.clock.Add(auth.TOTPPeriod)
+			form := authorizeForm(client, email)
+			for name, value := range c.values() {
+				form[name] = value
+			}
+
+			res := api.request(t, "POST", "/oauth/authorize", "", form)
+			if res.code != c.wantCode {
+				t.Fatalf("POST /oauth/authorize got %d %s, want %d", res.code, res.body, c.wantCode)
+			}
+			if res.code == http.StatusFound && redirectQuery(t, res).Get("code") == "" {
+				t.Errorf("POST /oauth/authorize redirected to %s, want a code", res.header.Get("Location"))
+			}
+		})
+	}
+
+	// a recovery code works once
+	form := authorizeForm(client, email)
+	form.Set("recovery_code", recoveryCodes[0])
+	res := api.request(t, "POST", "/oauth/authorize", "", form)
+	if res.code != http.StatusUnauthorized {
+		t.Errorf("POST /oauth/authorize with a used recovery code got %d, want %d", res.code, http.StatusUnauthorized)
+	}
+}
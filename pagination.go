@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	pageLimitDefault = 20
+	pageLimitMax     = 100
+)
+
+// pageCursor marks the last row of a page. It is handed to clients as an
+// opaque string and decoded back when they ask for the next page.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	Rank      *float32  `json:"r,omitempty"`
+}
+
+func (c pageCursor) encode() string {
+	dat, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	cursor := pageCursor{}
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, errors.New("malformed cursor")
+	}
+	err = json.Unmarshal(dat, &cursor)
+	if err != nil || cursor.ID == uuid.Nil {
+		return cursor, errors.New("malformed cursor")
+	}
+	return cursor, nil
+}
+
+type pageRequest struct {
+	limit  int32
+	cursor *pageCursor
+}
+
+// parsePageRequest reads the `limit` and `cursor` query parameters.
+func parsePageRequest(r *http.Request) (pageRequest, error) {
+	page := pageRequest{limit: pageLimitDefault}
+
+	limitString := r.URL.Query().Get("limit")
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		page.limit = int32(min(limit, pageLimitMax))
+	}
+
+	cursorString := r.URL.Query().Get("cursor")
+	if cursorString != "" {
+		cursor, err := decodeCursor(cursorString)
+		if err != nil {
+			return page, err
+		}
+		page.cursor = &cursor
+	}
+
+	return page, nil
+}
+
+// fetchLimit is one more than the page size, the extra row tells whether
+// there is a next page at all.
+func (p pageRequest) fetchLimit() int32 {
+	return p.limit + 1
+}
+
+func (p pageRequest) cursorCreatedAt() sql.NullTime {
+	if p.cursor == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: p.cursor.CreatedAt, Valid: true}
+}
+
+func (p pageRequest) cursorID() uuid.NullUUID {
+	if p.cursor == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: p.cursor.ID, Valid: true}
+}
+
+func (p pageRequest) cursorRank() sql.NullFloat64 {
+	if p.cursor == nil || p.cursor.Rank == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: float64(*p.cursor.Rank), Valid: true}
+}
+
+// pageTrim cuts the extra row fetched by fetchLimit and returns the cursor
+// pointing at the last row of the page, or "" when there are no more rows.
+func pageTrim[T any](rows []T, p pageRequest, key func(T) pageCursor) ([]T, string) {
+	if len(rows) <= int(p.limit) {
+		return rows, ""
+	}
+	rows = rows[:p.limit]
+	return rows, key(rows[len(rows)-1]).encode()
+}
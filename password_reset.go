@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/el-damiano/bootdev-http-server/internal/mail"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+// mailSend sends an email in the background, so how long it takes tells
+// nothing about whether there was anyone to send it to.
+func (cfg *apiConfig) mailSend(msg mail.Message) {
+	go func() {
+		err := cfg.mailer.Send(context.Background(), msg)
+		if err != nil {
+			log.Printf("Error sending email: %s", err)
+		}
+	}()
+}
+
+// passwordForgotHandler emails a reset token to the address given. It always
+// succeeds, revealing nothing about which emails have accounts.
+func (cfg *apiConfig) passwordForgotHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	email := strings.TrimSpace(params.Email)
+	if email == "" {
+		respondWithValidationErrors(w, validationErrors{"email": errors.New("email is required")})
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByEmail(context.Background(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error requesting a password reset", err)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error requesting a password reset", err)
+		return
+	}
+
+	err = cfg.dbQueries.CreatePasswordResetToken(context.Background(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: cfg.now().UTC().Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error requesting a password reset", err)
+		return
+	}
+
+	cfg.mailSend(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"If it was you, send this token along with your new password to\n"+
+			"POST /api/password/reset within an hour:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email, your password stays the same.\n", token),
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// passwordResetHandler sets a new password with a token from
+// passwordForgotHandler. Every session of the user is logged out, whoever
+// knew the old password shouldn't stay logged in.
+func (cfg *apiConfig) passwordResetHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	if params.Token == "" {
+		respondWithValidationErrors(w, validationErrors{"token": errors.New("token is required")})
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting the password", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	resetToken, err := qtx.GetPasswordResetTokenForUpdate(context.Background(), database.GetPasswordResetTokenForUpdateParams{
+		TokenHash: auth.HashToken(params.Token),
+		Now:       cfg.now().UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Reset token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting the password", err)
+		return
+	}
+
+	// checked only now, the password can't be the email of the account
+	user, err := qtx.GetUserByID(context.Background(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting the password", err)
+		return
+	}
+	err = cfg.passwordParam(params.Password, user.Email)
+	if err != nil {
+		respondWithValidationErrors(w, validationErrors{"password": err})
+		return
+	}
+
+	passwordHashed, err := cfg.passwords.Hash(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error hashing password", err)
+		return
+	}
+
+	_, err = qtx.UpdateUserAccount(context.Background(), database.UpdateUserAccountParams{
+		HashedPassword: sql.NullString{String: passwordHashed, Valid: true},
+		ID:             resetToken.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting the password", err)
+		return
+	}
+
+	// the other tokens sent in the meantime are spent as well
+	err = qtx.UsePasswordResetTokens(context.Background(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting the password", err)
+		return
+	}
+
+	err = qtx.RevokeUserRefreshTokens(context.Background(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting the password", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting the password", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/el-damiano/bootdev-http-server/internal/chirptext"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	displayNameLenMax = 50
+	bioLenMax         = 160
+	locationLenMax    = 30
+	websiteLenMax     = 100
+)
+
+// Profile is the public side of a user, it never holds the email or tokens.
+type Profile struct {
+	ID          uuid.UUID `json:"id"`
+	Username    string    `json:"username,omitempty"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	Location    string    `json:"location"`
+	Website     string    `json:"website"`
+	Avatar      *Media    `json:"avatar"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) profileResponse(user database.User) (Profile, error) {
+	profile := Profile{
+		ID:          user.ID,
+		Username:    user.Username.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Location:    user.Location,
+		Website:     user.Website,
+		IsChirpyRed: user.IsChirpyRed,
+		CreatedAt:   user.CreatedAt,
+	}
+
+	if user.AvatarMediaID.Valid {
+		avatar, err := cfg.dbQueries.GetMediaAttachmentByID(context.Background(), user.AvatarMediaID.UUID)
+		if err != nil {
+			return Profile{}, err
+		}
+		avatarResponse := mediaFromDB(avatar)
+		profile.Avatar = &avatarResponse
+	}
+	return profile, nil
+}
+
+func (cfg *apiConfig) profileRespond(w http.ResponseWriter, code int, user database.User) {
+	profile, err := cfg.profileResponse(user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the profile", err)
+		return
+	}
+	respondWithJSON(w, code, profile)
+}
+
+func (cfg *apiConfig) profileHandler(w http.ResponseWriter, r *http.Request) {
+	idOrHandle := r.PathValue("idOrHandle")
+
+	var user database.User
+	var err error
+	userID, errParse := uuid.Parse(idOrHandle)
+	switch {
+	case errParse == nil:
+		user, err = cfg.dbQueries.GetUserByID(context.Background(), userID)
+	case chirptext.ValidUsername(idOrHandle):
+		user, err = cfg.dbQueries.GetUserByUsername(context.Background(), idOrHandle)
+	default:
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the user", err)
+		return
+	}
+
+	cfg.profileRespond(w, http.StatusOK, user)
+}
+
+func (cfg *apiConfig) profileUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	// fields left out are kept as they are
+	type parameters struct {
+		Username    *string `json:"username"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		Location    *string `json:"location"`
+		Website     *string `json:"website"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	updateParams := database.UpdateUserProfileParams{ID: userID}
+	if params.Username != nil {
+		updateParams.Username, err = usernameParam(*params.Username)
+		if err == nil && !updateParams.Username.Valid {
+			err = errors.New("username can't be removed")
+		}
+		if err != nil {
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
+			return
+		}
+	}
+	for _, field := range []struct {
+		name   string
+		value  *string
+		lenMax int
+		param  *sql.NullString
+	}{
+		{"display_name", params.DisplayName, displayNameLenMax, &updateParams.DisplayName},
+		{"bio", params.Bio, bioLenMax, &updateParams.Bio},
+		{"location", params.Location, locationLenMax, &updateParams.Location},
+	} {
+		if field.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*field.value)
+		if utf8.RuneCountInString(value) > field.lenMax {
+			err = fmt.Errorf("%s must be at most %d characters", field.name, field.lenMax)
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
+			return
+		}
+		*field.param = sql.NullString{String: value, Valid: true}
+	}
+	if params.Website != nil {
+		website, err := websiteParam(*params.Website)
+		if err != nil {
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error(), err)
+			return
+		}
+		updateParams.Website = sql.NullString{String: website, Valid: true}
+	}
+
+	user, err := cfg.dbQueries.UpdateUserProfile(context.Background(), updateParams)
+	if usernameTaken(err) {
+		respondWithError(w, http.StatusConflict, "Username is already taken", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating the profile", err)
+		return
+	}
+
+	cfg.profileRespond(w, http.StatusOK, user)
+}
+
+// websiteParam validates a website, "" removes it.
+func websiteParam(website string) (string, error) {
+	website = strings.TrimSpace(website)
+	if website == "" {
+		return "", nil
+	}
+
+	websiteURL, err := url.Parse(website)
+	if err != nil || (websiteURL.Scheme != "http" && websiteURL.Scheme != "https") || websiteURL.Host == "" {
+		return "", errors.New("website must be an http or https URL")
+	}
+	if len(website) > websiteLenMax {
+		return "", fmt.Errorf("website must be at most %d characters", websiteLenMax)
+	}
+	return website, nil
+}
+
+func (cfg *apiConfig) avatarSetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	type parameters struct {
+		MediaID uuid.UUID `json:"media_id"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	avatar, err := cfg.dbQueries.GetMediaAttachmentByID(context.Background(), params.MediaID)
+	if err != nil || avatar.UserID != userID || avatar.ChirpID.Valid {
+		respondWithError(w, http.StatusUnprocessableEntity, "Media doesn't exist, isn't yours or is attached to a chirp", err)
+		return
+	}
+
+	user, err := cfg.avatarReplace(userID, uuid.NullUUID{UUID: avatar.ID, Valid: true})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error setting the avatar", err)
+		return
+	}
+
+	cfg.profileRespond(w, http.StatusOK, user)
+}
+
+func (cfg *apiConfig) avatarDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	_, err = cfg.avatarReplace(userID, uuid.NullUUID{})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error removing the avatar", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// avatarReplace sets the avatar of a user and deletes the one it replaces.
+func (cfg *apiConfig) avatarReplace(userID uuid.UUID, avatarID uuid.NullUUID) (database.User, error) {
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	user, err := qtx.GetUserByID(context.Background(), userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	previousID := user.AvatarMediaID
+
+	user, err = qtx.SetUserAvatar(context.Background(), database.SetUserAvatarParams{
+		AvatarMediaID: avatarID,
+		ID:            userID,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	var previous database.MediaAttachment
+	if previousID.Valid && previousID != avatarID {
+		previous, err = qtx.GetMediaAttachmentByID(context.Background(), previousID.UUID)
+		if err != nil {
+			return database.User{}, err
+		}
+		err = qtx.DeleteMediaAttachment(context.Background(), previous.ID)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if previous.ID != uuid.Nil {
+		cfg.mediaDeleteBlobs(previous.BlobKey, previous.ThumbnailKey)
+	}
+	return user, nil
+}
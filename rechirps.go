@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func (cfg *apiConfig) rechirpHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Rechirping failed", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	original, err := chirpTarget(qtx, chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+	originalID := uuid.NullUUID{UUID: original.ID, Valid: true}
+
+	rechirp, err := qtx.GetRechirp(context.Background(), database.GetRechirpParams{
+		UserID:     userID,
+		OriginalID: originalID,
+	})
+	if err == nil {
+		cfg.chirpRespond(w, http.StatusOK, rechirp, userID)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, "Rechirping failed", err)
+		return
+	}
+
+	rechirp, err = qtx.CreateChirp(context.Background(), database.CreateChirpParams{
+		UserID:     userID,
+		Kind:       chirpKindRechirp,
+		OriginalID: originalID,
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		// rechirped by a concurrent request in the meantime
+		respondWithError(w, http.StatusConflict, "Chirp is already rechirped", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Rechirping failed", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Rechirping failed", err)
+		return
+	}
+
+	cfg.chirpRespond(w, http.StatusCreated, rechirp, userID)
+}
+
+func (cfg *apiConfig) unrechirpHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+
+	// undoing a rechirp works through the rechirp itself too
+	chirpDB, err := cfg.dbQueries.GetChirpByID(context.Background(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Getting chirp failed", err)
+		return
+	}
+	originalID := uuid.NullUUID{UUID: chirpDB.ID, Valid: true}
+	if chirpDB.Kind == chirpKindRechirp {
+		originalID = chirpDB.OriginalID
+	}
+
+	_, err = cfg.dbQueries.DeleteRechirp(context.Background(), database.DeleteRechirpParams{
+		UserID:     userID,
+		OriginalID: originalID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Undoing rechirp failed", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
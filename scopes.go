@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/google/uuid"
+)
+
+type principalKey struct{}
+
+// principal is who made a request and what they may do.
+type principal struct {
+	userID uuid.UUID
+	// scopes limits what the request may do, nil for the access tokens of
+	// the user's own logins, which may do anything.
+	scopes []auth.Scope
+}
+
+func (p principal) allows(scope auth.Scope) bool {
+	return p.scopes == nil || slices.Contains(p.scopes, scope)
+}
+
+// withScope lets routes be used with API keys having the scope, as well as
+// with access tokens. Who made the request is handed on to authenticate.
+// Requests without valid access tokens are handed on as they are, for the
+// handler to turn away or serve anonymously like before.
+func (cfg *apiConfig) withScope(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := cfg.principal(r)
+		if errors.Is(err, errAPIKeyInvalid) {
+			respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid or revoked API key", err)
+			return
+		}
+		if errors.Is(err, errAPIKeyLookup) {
+			respondWithError(w, http.StatusInternalServerError, "Error checking the API key", err)
+			return
+		}
+		if errors.Is(err, errAccessTokenRevoked) {
+			respondWithError(w, http.StatusUnauthorized, "Authorization failed: the app's access was revoked", err)
+			return
+		}
+		if errors.Is(err, errAccessTokenLookup) {
+			respondWithError(w, http.StatusInternalServerError, "Error checking the access token", err)
+			return
+		}
+		if err != nil {
+			next(w, r)
+			return
+		}
+		if !p.allows(scope) {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("Authorization failed: missing the %s scope", scope), nil)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// principal authenticates the request by its Authorization header, either
+// "Bearer <access token>" or "ApiKey <API key>". Access tokens of OAuth
+// clients are limited to their scopes like API keys, and stop working as
+// soon as the app is revoked or deleted rather than when they expire.
+func (cfg *apiConfig) principal(r *http.Request) (principal, error) {
+	key, err := auth.APIKey(r.Header)
+	if err == nil {
+		return cfg.apiKeyPrincipal(key)
+	}
+
+	tokenBearer, err := auth.BearerToken(r.Header)
+	if err != nil {
+		return principal{}, err
+	}
+	token, err := cfg.keyRing.ParseJWT(tokenBearer)
+	if err != nil {
+		return principal{}, err
+	}
+	p := principal{userID: token.UserID}
+	if token.ClientID != "" {
+		active, err := cfg.sessionActive(token.SessionID)
+		if err != nil {
+			return principal{}, fmt.Errorf("%w: %w", errAccessTokenLookup, err)
+		}
+		if !active {
+			return principal{}, errAccessTokenRevoked
+		}
+		p.scopes = token.Scopes
+	}
+	return p, nil
+}
+
+var (
+	errAPIKeyInvalid      = errors.New("invalid or revoked API key")
+	errAPIKeyLookup       = errors.New("error looking up API key")
+	errAccessTokenRevoked = errors.New("access token of a revoked session")
+	errAccessTokenLookup  = errors.New("error looking up the session of the access token")
+)
+
+func (cfg *apiConfig) apiKeyPrincipal(key string) (principal, error) {
+	if !auth.IsUserAPIKey(key) {
+		return principal{}, errAPIKeyInvalid
+	}
+	apiKey, err := cfg.dbQueries.GetAPIKeyByHash(context.Background(), auth.HashToken(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return principal{}, errAPIKeyInvalid
+	}
+	if err != nil {
+		return principal{}, fmt.Errorf("%w: %w", errAPIKeyLookup, err)
+	}
+
+	// the key works either way, it's just when it was last used that's off
+	err = cfg.dbQueries.TouchAPIKey(context.Background(), apiKey.ID)
+	if err != nil {
+		log.Printf("Error updating when API key %s was last used: %s", apiKey.ID, err)
+	}
+
+	scopes := make([]auth.Scope, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		scopes = append(scopes, auth.Scope(scope))
+	}
+	return principal{userID: apiKey.UserID, scopes: scopes}, nil
+}
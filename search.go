@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/el-damiano/bootdev-http-server/internal/search"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) chirpsSearchHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := search.TSQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if page.cursor != nil && page.cursor.Rank == nil {
+		respondWithError(w, http.StatusBadRequest, "malformed cursor", nil)
+		return
+	}
+
+	params := database.SearchChirpsParams{
+		Query:           query,
+		CursorRank:      page.cursorRank(),
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	}
+
+	authorIDString := r.URL.Query().Get("author_id")
+	if authorIDString != "" {
+		authorID, err := uuid.Parse(authorIDString)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author_id", err)
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+
+	params.Since, err = queryTime(r, "since")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp", err)
+		return
+	}
+	params.Until, err = queryTime(r, "until")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "until must be an RFC 3339 timestamp", err)
+		return
+	}
+
+	results, err := cfg.dbQueries.SearchChirps(context.Background(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error searching the chirps", err)
+		return
+	}
+
+	results, nextCursor := pageTrim(results, page, func(result database.SearchChirpsRow) pageCursor {
+		return pageCursor{CreatedAt: result.Chirp.CreatedAt, ID: result.Chirp.ID, Rank: &result.Rank}
+	})
+
+	chirps := make([]database.Chirp, 0, len(results))
+	for _, result := range results {
+		chirps = append(chirps, result.Chirp)
+	}
+
+	chirpsResponse, err := cfg.chirpsResponse(chirps, cfg.viewer(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error searching the chirps", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpsPage{
+		Chirps:     chirpsResponse,
+		NextCursor: nextCursor,
+	})
+}
+
+func queryTime(r *http.Request, key string) (sql.NullTime, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// Security events worth keeping a record of for an account.
+const (
+	securityEventRefreshTokenReuse = "refresh_token_reuse"
+	securityEventAccountLocked     = "account_locked"
+	securityEventAccountUnlocked   = "account_unlocked"
+	securityEventPasswordChanged   = "password_changed"
+	securityEventOAuthAuthorized   = "oauth_authorized"
+	securityEventOAuthCodeReuse    = "oauth_code_reuse"
+)
+
+// securityEventLog records a security event for the user, logging it too so
+// it shows up next to the request that caused it.
+func securityEventLog(q *database.Queries, userID uuid.UUID, event, detail string) error {
+	log.Printf("Security event %s for user %s: %s", event, userID, detail)
+	return q.CreateSecurityEvent(context.Background(), database.CreateSecurityEventParams{
+		UserID: userID,
+		Event:  event,
+		Detail: detail,
+	})
+}
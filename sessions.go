@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// userAgentLenMax keeps a client from storing novels as its user agent.
+const userAgentLenMax = 512
+
+// Session is a login on a device, kept alive by refreshing its tokens.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+	// ClientID is the OAuth client the session was authorized for, limited
+	// to the Scopes. Logins have neither.
+	ClientID *uuid.UUID `json:"client_id,omitempty"`
+	Scopes   []string   `json:"scopes,omitempty"`
+}
+
+// sessionFromDB returns the session of the token family the refresh token
+// belongs to.
+func sessionFromDB(token database.RefreshToken, currentID uuid.UUID) Session {
+	session := Session{
+		ID:         token.FamilyID,
+		UserAgent:  token.UserAgent,
+		IP:         token.Ip,
+		CreatedAt:  token.FamilyCreatedAt,
+		LastUsedAt: token.LastUsedAt,
+		ExpiresAt:  token.ExpiresAt,
+		Current:    token.FamilyID == currentID,
+		Scopes:     token.Scopes,
+	}
+	if token.ClientID.Valid {
+		session.ClientID = &token.ClientID.UUID
+	}
+	return session
+}
+
+func userAgent(r *http.Request) string {
+	agent := r.UserAgent()
+	if len(agent) > userAgentLenMax {
+		agent = strings.ToValidUTF8(agent[:userAgentLenMax], "")
+	}
+	return agent
+}
+
+// clientIP returns the address the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// authenticateSession is authenticate returning the session of the access
+// token as well, uuid.Nil for tokens from before sessions.
+func (cfg *apiConfig) authenticateSession(r *http.Request) (uuid.UUID, uuid.UUID, error) {
+	tokenBearer, err := auth.BearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	return cfg.keyRing.ValidateJWT(tokenBearer)
+}
+
+// sessionActive tells whether the session still has a refresh token that
+// isn't revoked or expired, by the same clock refreshTokenRotate expires
+// them by. Deleting an OAuth client deletes its tokens too.
+func (cfg *apiConfig) sessionActive(sessionID uuid.UUID) (bool, error) {
+	active, err := cfg.dbQueries.CountActiveRefreshTokenFamily(context.Background(), database.CountActiveRefreshTokenFamilyParams{
+		FamilyID: sessionID,
+		Now:      cfg.now().UTC(),
+	})
+	if err != nil {
+		return false, err
+	}
+	return active > 0, nil
+}
+
+func (cfg *apiConfig) sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, sessionID, err := cfg.authenticateSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	tokens, err := cfg.dbQueries.GetUserSessions(context.Background(), database.GetUserSessionsParams{
+		UserID: userID,
+		Now:    cfg.now().UTC(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving sessions", err)
+		return
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, sessionFromDB(token, sessionID))
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+// sessionDeleteHandler logs out a session by revoking its refresh token. Its
+// access tokens keep working until they expire, within the hour.
+func (cfg *apiConfig) sessionDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	revoked, err := cfg.dbQueries.RevokeUserSession(context.Background(), database.RevokeUserSessionParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking session", err)
+		return
+	}
+	if len(revoked) == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionsRevokeAllHandler logs out every session but the one making the
+// request.
+func (cfg *apiConfig) sessionsRevokeAllHandler(w http.ResponseWriter, r *http.Request) {
+	userID, sessionID, err := cfg.authenticateSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	err = cfg.dbQueries.RevokeUserRefreshTokensExcept(context.Background(), database.RevokeUserRefreshTokensExceptParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking sessions", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSessionsHandler(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+
+	cases := map[string]struct {
+		// wait is how long after the first login the user logs in again
+		wait         time.Duration
+		wantSessions int
+	}{
+		"both sessions": {
+			wantSessions: 2,
+		},
+		"first session just before it expires": {
+			wait:         refreshTokenTTL - time.Second,
+			wantSessions: 2,
+		},
+		"first session expired": {
+			wait:         refreshTokenTTL,
+			wantSessions: 1,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			email := api.userCreate(t)
+			userFirst := api.login(t, email, testPassword)
+			api.clock.Add(c.wait)
+			user := api.login(t, email, testPassword)
+
+			res := api.request(t, "GET", "/api/sessions", bearer(user.Token), nil)
+			if res.code != http.StatusOK {
+				t.Fatalf("GET /api/sessions got %d %s, want %d", res.code, res.body, http.StatusOK)
+			}
+			sessions := []Session{}
+			res.decode(t, &sessions)
+			if len(sessions) != c.wantSessions {
+				t.Errorf("GET /api/sessions got %d sessions, want %d", len(sessions), c.wantSessions)
+			}
+
+			// listed exactly when it can still be refreshed
+			res = api.request(t, "POST", "/api/refresh", bearer(userFirst.TokenRefresh), nil)
+			if refreshed := res.code == http.StatusOK; refreshed != (c.wantSessions == 2) {
+				t.Errorf("POST /api/refresh of the first session got %d %s", res.code, res.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+)
+
+const (
+	// signingKeysReload is how often the key ring picks up keys rotated by
+	// other instances or the rotate-key command.
+	signingKeysReload = time.Minute
+	// signingKeyPublish is how long a new key only verifies before it signs,
+	// long enough for every instance to reload and JWKS caches to expire.
+	signingKeyPublish = 2 * signingKeysReload
+)
+
+// SigningKeyInfo describes a signing key without giving it away.
+type SigningKeyInfo struct {
+	ID        string     `json:"id"`
+	Algorithm string     `json:"algorithm"`
+	CreatedAt time.Time  `json:"created_at"`
+	SignsAt   time.Time  `json:"signs_at"`
+	RetiresAt *time.Time `json:"retires_at"`
+}
+
+func signingKeyInfoFromDB(key database.SigningKey) SigningKeyInfo {
+	info := SigningKeyInfo{
+		ID:        key.ID,
+		Algorithm: key.Algorithm,
+		CreatedAt: key.CreatedAt,
+		SignsAt:   key.SignsAt,
+	}
+	if key.RetiresAt.Valid {
+		info.RetiresAt = &key.RetiresAt.Time
+	}
+	return info
+}
+
+// createFirstSigningKey makes the first signing key with the algorithm if
+// there's none yet. Nobody has tokens to verify yet, so it signs right away.
+// Servers starting together take turns, the ones after the first find its
+// key, so they all sign with the same one.
+func (cfg *apiConfig) createFirstSigningKey() error {
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = qtx.LockSigningKeys(context.Background())
+	if err != nil {
+		return err
+	}
+	count, err := qtx.CountSigningKeys(context.Background())
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = signingKeyCreate(qtx, cfg.secrets, cfg.signingAlgorithm, cfg.now())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// loadSigningKeys fills the key ring with the keys that haven't retired.
+// Tokens signed with SECRET are accepted until the last ones made before the
+// first key have expired.
+func (cfg *apiConfig) loadSigningKeys() error {
+	rows, err := cfg.dbQueries.GetSigningKeys(context.Background(), cfg.now().UTC())
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		// only ever made by createFirstSigningKey, a key made here would
+		// sign before the other servers have it
+		return errors.New("no signing keys")
+	}
+
+	keys := make([]*auth.SigningKey, 0, len(rows))
+	for _, row := range rows {
+		keyPEM, err := openSecret(cfg.secrets, row.PrivateKey, signingKeySecretOf(row.ID))
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.ID, err)
+		}
+		key, err := auth.ParseSigningKey(row.Algorithm, keyPEM)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.ID, err)
+		}
+		key.SignsAt = row.SignsAt
+		keys = append(keys, key)
+	}
+
+	firstCreatedAt, err := cfg.dbQueries.GetFirstSigningKeyCreatedAt(context.Background())
+	if err != nil {
+		return err
+	}
+	cfg.keyRing.AcceptLegacyUntil(firstCreatedAt.Add(accessTokenTTL))
+
+	return cfg.keyRing.Load(keys)
+}
+
+// reloadSigningKeys keeps reloading the key ring in the background.
+func (cfg *apiConfig) reloadSigningKeys() {
+	for range time.Tick(signingKeysReload) {
+		err := cfg.loadSigningKeys()
+		if err != nil {
+			log.Printf("Error reloading signing keys: %s", err)
+		}
+	}
+}
+
+// signingKeyRotate makes a new key to sign access tokens with from signsAt.
+// Until then it only verifies, so no server rejects the tokens it signs for
+// not having loaded it yet. The old keys keep verifying tokens until the
+// last ones they signed expire, so nobody is logged out.
+func signingKeyRotate(db *sql.DB, dbQueries *database.Queries, secrets *auth.SecretBox, algorithm string, signsAt time.Time) (database.SigningKey, error) {
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return database.SigningKey{}, err
+	}
+	defer tx.Rollback()
+	qtx := dbQueries.WithTx(tx)
+
+	row, err := signingKeyCreate(qtx, secrets, algorithm, signsAt)
+	if err != nil {
+		return database.SigningKey{}, err
+	}
+
+	// the old keys sign until signsAt, with a reload to spare for clocks
+	// that are off
+	err = qtx.RetireSigningKeys(context.Background(), database.RetireSigningKeysParams{
+		ID:        row.ID,
+		RetiresAt: sql.NullTime{Time: signsAt.UTC().Add(accessTokenTTL + signingKeysReload), Valid: true},
+	})
+	if err != nil {
+		return database.SigningKey{}, err
+	}
+
+	return row, tx.Commit()
+}
+
+// signingKeyCreate generates a key with the algorithm and stores it sealed,
+// to sign from signsAt.
+func signingKeyCreate(qtx *database.Queries, secrets *auth.SecretBox, algorithm string, signsAt time.Time) (database.SigningKey, error) {
+	key, err := auth.GenerateSigningKey(algorithm)
+	if err != nil {
+		return database.SigningKey{}, err
+	}
+	keyPEM, err := key.MarshalPEM()
+	if err != nil {
+		return database.SigningKey{}, err
+	}
+	keySealed, err := secrets.Seal(keyPEM, signingKeySecretOf(key.ID))
+	if err != nil {
+		return database.SigningKey{}, err
+	}
+
+	return qtx.CreateSigningKey(context.Background(), database.CreateSigningKeyParams{
+		ID:         key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: keySealed,
+		SignsAt:    signsAt.UTC(),
+	})
+}
+
+// signingKeySecretOf is what the private key of a signing key is sealed for,
+// so it only opens as the key with the ID.
+func signingKeySecretOf(id string) string {
+	return "signing key " + id
+}
+
+// sealSigningKeys seals the private keys stored in the clear by versions
+// from before they were sealed.
+func (cfg *apiConfig) sealSigningKeys() error {
+	rows, err := cfg.dbQueries.GetAllSigningKeys(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if auth.IsSealed(row.PrivateKey) {
+			continue
+		}
+		keySealed, err := cfg.secrets.Seal(row.PrivateKey, signingKeySecretOf(row.ID))
+		if err != nil {
+			return err
+		}
+		err = cfg.dbQueries.SealSigningKey(context.Background(), database.SealSigningKeyParams{
+			ID:         row.ID,
+			PrivateKey: keySealed,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotateKeyCommand rotates the signing key from the command line, for when
+// the server isn't running or has no ADMIN_KEY.
+func rotateKeyCommand(db *sql.DB, dbQueries *database.Queries, secrets *auth.SecretBox, args []string, algorithm string) error {
+	flags := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	flags.StringVar(&algorithm, "alg", algorithm, "algorithm of the new key: EdDSA, RS256 or ES256")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	row, err := signingKeyRotate(db, dbQueries, secrets, algorithm, time.Now().Add(signingKeyPublish))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("New %s signing key %s, running servers sign with it from %s\n", row.Algorithm, row.ID, row.SignsAt.Format(time.RFC3339))
+	return nil
+}
+
+// jwksHandler publishes the public keys, for other services to verify
+// access tokens with.
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(signingKeysReload.Seconds())))
+	respondWithJSON(w, http.StatusOK, cfg.keyRing.JWKS())
+}
+
+func (cfg *apiConfig) signingKeyRotateHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	type parameters struct {
+		Algorithm string `json:"algorithm"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+	switch params.Algorithm {
+	case "":
+		params.Algorithm = cfg.signingAlgorithm
+	case auth.AlgorithmEdDSA, auth.AlgorithmRS256, auth.AlgorithmES256:
+	default:
+		respondWithValidationErrors(w, validationErrors{"algorithm": errors.New("algorithm must be EdDSA, RS256 or ES256")})
+		return
+	}
+
+	row, err := signingKeyRotate(cfg.db, cfg.dbQueries, cfg.secrets, params.Algorithm, cfg.now().Add(signingKeyPublish))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error rotating the signing key", err)
+		return
+	}
+
+	err = cfg.loadSigningKeys()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error loading the signing keys", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, signingKeyInfoFromDB(row))
+}
+
+func (cfg *apiConfig) signingKeysHandler(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authorizeAdmin(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed", err)
+		return
+	}
+
+	rows, err := cfg.dbQueries.GetSigningKeys(context.Background(), cfg.now().UTC())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error retrieving the signing keys", err)
+		return
+	}
+
+	keys := make([]SigningKeyInfo, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, signingKeyInfoFromDB(row))
+	}
+
+	respondWithJSON(w, http.StatusOK, keys)
+}
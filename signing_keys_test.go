@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenKeyID returns the kid of the key a token was signed with.
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("Error parsing %q: %v", token, err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestJWKSHandler(t *testing.T) {
+	api := newTestAPI(t, nil)
+
+	res := api.request(t, "GET", "/.well-known/jwks.json", "", nil)
+	if res.code != http.StatusOK {
+		t.Fatalf("GET /.well-known/jwks.json got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+	if got, want := res.header.Get("Cache-Control"), "public, max-age=60"; got != want {
+		t.Errorf("GET /.well-known/jwks.json Cache-Control = %q, want %q", got, want)
+	}
+
+	jwks := auth.JWKSet{}
+	res.decode(t, &jwks)
+	want := api.cfg.keyRing.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0] != want.Keys[0] {
+		t.Errorf("GET /.well-known/jwks.json got %+v, want %+v", jwks, want)
+	}
+}
+
+func TestSigningKeyRotateHandler(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+
+	cases := map[string]struct {
+		authorization string
+		body          any
+		wantCode      int
+		wantAlgorithm string
+	}{
+		"default algorithm": {
+			authorization: "ApiKey " + testAdminKey,
+			wantCode:      http.StatusCreated,
+			wantAlgorithm: auth.AlgorithmEdDSA,
+		},
+		"ES256": {
+			authorization: "ApiKey " + testAdminKey,
+			body:          map[string]string{"algorithm": auth.AlgorithmES256},
+			wantCode:      http.StatusCreated,
+			wantAlgorithm: auth.AlgorithmES256,
+		},
+		"symmetric algorithm": {
+			authorization: "ApiKey " + testAdminKey,
+			body:          map[string]string{"algorithm": "HS256"},
+			wantCode:      http.StatusUnprocessableEntity,
+		},
+		"no admin key": {
+			wantCode: http.StatusUnauthorized,
+		},
+		"wrong admin key": {
+			authorization: "ApiKey otter",
+			wantCode:      http.StatusUnauthorized,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			res := api.request(t, "POST", "/admin/keys/rotate", c.authorization, c.body)
+			if res.code != c.wantCode {
+				t.Fatalf("POST /admin/keys/rotate got %d %s, want %d", res.code, res.body, c.wantCode)
+			}
+			if res.code == http.StatusUnprocessableEntity {
+				if _, ok := res.fields(t)["algorithm"]; !ok {
+					t.Errorf("POST /admin/keys/rotate got %s, want the algorithm to fail validation", res.body)
+				}
+			}
+			if res.code != http.StatusCreated {
+				return
+			}
+
+			key := SigningKeyInfo{}
+			res.decode(t, &key)
+			if key.Algorithm != c.wantAlgorithm {
+				t.Errorf("POST /admin/keys/rotate made a %s key, want %s", key.Algorithm, c.wantAlgorithm)
+			}
+			if want := api.clock.Now().Add(signingKeyPublish); key.SignsAt.Sub(want).Abs() > time.Millisecond {
+				t.Errorf("POST /admin/keys/rotate made a key signing at %s, want %s", key.SignsAt, want)
+			}
+		})
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	email := api.userCreate(t)
+	userBefore := api.login(t, email, testPassword)
+	keyOld := tokenKeyID(t, userBefore.Token)
+
+	res := api.request(t, "POST", "/admin/keys/rotate", "ApiKey "+testAdminKey, nil)
+	if res.code != http.StatusCreated {
+		t.Fatalf("POST /admin/keys/rotate got %d %s, want %d", res.code, res.body, http.StatusCreated)
+	}
+	keyNew := SigningKeyInfo{}
+	res.decode(t, &keyNew)
+
+	// published right away, for every server to verify with before it signs
+	res = api.request(t, "GET", "/.well-known/jwks.json", "", nil)
+	jwks := auth.JWKSet{}
+	res.decode(t, &jwks)
+	if len(jwks.Keys) != 2 || jwks.Keys[0].ID != keyOld || jwks.Keys[1].ID != keyNew.ID {
+		t.Errorf("GET /.well-known/jwks.json got %+v, want %s signing and %s published", jwks.Keys, keyOld, keyNew.ID)
+	}
+	if got := tokenKeyID(t, api.login(t, email, testPassword).Token); got != keyOld {
+		t.Errorf("login before the new key signs got a token of %s, want %s", got, keyOld)
+	}
+
+	api.clock.Add(signingKeyPublish)
+	userAfter := api.login(t, email, testPassword)
+	if got := tokenKeyID(t, userAfter.Token); got != keyNew.ID {
+		t.Errorf("login after the new key signs got a token of %s, want %s", got, keyNew.ID)
+	}
+
+	// nobody is logged out
+	for _, user := range []User{userBefore, userAfter} {
+		res = api.request(t, "GET", "/api/sessions", bearer(user.Token), nil)
+		if res.code != http.StatusOK {
+			t.Errorf("GET /api/sessions with a token of %s got %d %s, want %d", tokenKeyID(t, user.Token), res.code, res.body, http.StatusOK)
+		}
+	}
+}
+
+func TestCreateFirstSigningKey(t *testing.T) {
+	db := testDB(t)
+	dbQueries := database.New(db)
+	secrets := testSecretBox(t)
+	servers := make([]*apiConfig, 5)
+	for i := range servers {
+		servers[i] = &apiConfig{
+			db:               db,
+			dbQueries:        dbQueries,
+			keyRing:          auth.NewKeyRing(""),
+			secrets:          secrets,
+			signingAlgorithm: auth.AlgorithmEdDSA,
+		}
+	}
+
+	// reloading never makes a key of its own
+	if err := servers[0].loadSigningKeys(); err == nil {
+		t.Fatalf("loadSigningKeys() without keys got no error")
+	}
+
+	// servers starting together on a new database
+	wg := sync.WaitGroup{}
+	errs := make([]error, len(servers))
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = server.createFirstSigningKey()
+			if errs[i] == nil {
+				errs[i] = server.loadSigningKeys()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("server %d error = %v", i, err)
+		}
+	}
+	count, err := dbQueries.CountSigningKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("servers starting together made %d signing keys, want 1", count)
+	}
+	for i, server := range servers {
+		if got, want := server.keyRing.JWKS(), servers[0].keyRing.JWKS(); len(got.Keys) != 1 || got.Keys[0] != want.Keys[0] {
+			t.Errorf("server %d loaded %+v, want %+v", i, got.Keys, want.Keys)
+		}
+	}
+}
+
+func TestSealSigningKeys(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	ctx := context.Background()
+
+	// a key stored in the clear before keys were sealed
+	legacy, err := auth.GenerateSigningKey(auth.AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyPEM, err := legacy.MarshalPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.cfg.dbQueries.CreateSigningKey(ctx, database.CreateSigningKeyParams{
+		ID:         legacy.ID,
+		Algorithm:  legacy.Algorithm,
+		PrivateKey: legacyPEM,
+		SignsAt:    api.clock.Now().UTC().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.cfg.loadSigningKeys(); err != nil {
+		t.Fatalf("loadSigningKeys() with a key in the clear error = %v", err)
+	}
+
+	if err := api.cfg.sealSigningKeys(); err != nil {
+		t.Fatalf("sealSigningKeys() error = %v", err)
+	}
+	rows, err := api.cfg.dbQueries.GetAllSigningKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d signing keys, want 2", len(rows))
+	}
+	for _, row := range rows {
+		if !auth.IsSealed(row.PrivateKey) || strings.Contains(row.PrivateKey, "PRIVATE KEY") {
+			t.Errorf("signing key %s stored as %q, want it sealed", row.ID, row.PrivateKey)
+		}
+	}
+	if err := api.cfg.loadSigningKeys(); err != nil {
+		t.Fatalf("loadSigningKeys() after sealing error = %v", err)
+	}
+
+	// a sealed key only opens as the key it was sealed for
+	err = api.cfg.dbQueries.SealSigningKey(ctx, database.SealSigningKeyParams{ID: rows[0].ID, PrivateKey: rows[1].PrivateKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.cfg.loadSigningKeys(); !errors.Is(err, auth.ErrSecretOpen) {
+		t.Errorf("loadSigningKeys() with a key copied over another error = %v, want %v", err, auth.ErrSecretOpen)
+	}
+}
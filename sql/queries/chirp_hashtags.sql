@@ -0,0 +1,32 @@
+-- name: CreateChirpHashtag :exec
+INSERT INTO chirp_hashtags (
+	chirp_id,
+	tag,
+	created_at
+) VALUES (
+	$1,
+	$2,
+	$3
+) ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: GetHashtagChirpsPage :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = sqlc.arg(tag)
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (chirp_hashtags.created_at, chirp_hashtags.chirp_id)
+	< (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY chirp_hashtags.created_at DESC, chirp_hashtags.chirp_id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetTrendingHashtags :many
+SELECT tag, count(*) AS chirp_count FROM chirp_hashtags
+WHERE created_at >= sqlc.arg(since)::timestamp
+GROUP BY tag
+ORDER BY chirp_count DESC, tag ASC
+LIMIT sqlc.arg(tag_limit);
@@ -0,0 +1,28 @@
+-- name: CreateChirpLike :execrows
+INSERT INTO chirp_likes (
+	chirp_id,
+	user_id,
+	created_at
+) VALUES (
+	$1,
+	$2,
+	now()
+) ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpLike :execrows
+DELETE FROM chirp_likes
+WHERE chirp_id = $1
+AND user_id = $2;
+
+-- name: GetChirpLikesPage :many
+SELECT * FROM chirp_likes
+WHERE chirp_id = sqlc.arg(chirp_id)
+AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (created_at, user_id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, user_id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetLikedChirpIDs :many
+SELECT chirp_id FROM chirp_likes
+WHERE user_id = sqlc.arg(user_id)
+AND chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
@@ -0,0 +1,30 @@
+-- name: CreateChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, start_offset, end_offset)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4
+);
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: GetChirpMentions :many
+SELECT * FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_id, start_offset;
+
+-- name: GetMentionsPage :many
+SELECT * FROM chirps
+WHERE EXISTS (
+	SELECT 1 FROM chirp_mentions
+	WHERE chirp_mentions.chirp_id = chirps.id
+	AND chirp_mentions.user_id = sqlc.arg(user_id)::uuid
+)
+AND deleted_at IS NULL
+AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_limit);
@@ -4,28 +4,152 @@ INSERT INTO chirps (
 	created_at,
 	updated_at,
 	body,
-	user_id
+	user_id,
+	parent_id,
+	root_id,
+	kind,
+	original_id
 ) VALUES (
 	gen_random_uuid(),
 	now(),
 	now(),
 	$1,
-	$2
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
 ) RETURNING *;
 
--- name: GetAllChirps :many
+-- name: GetChirpByID :one
+SELECT * FROM chirps
+WHERE id = $1;
+
+-- name: GetChirpsByIDs :many
 SELECT * FROM chirps
-ORDER BY created_at ASC;
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
 
--- name: GetUsersChirps :many
+-- name: GetRechirp :one
 SELECT * FROM chirps
 WHERE user_id = $1
-ORDER BY created_at ASC;
+AND original_id = $2
+AND kind = 'rechirp';
 
--- name: GetChirpByID :one
+-- name: GetChirpByIDForUpdate :one
 SELECT * FROM chirps
-WHERE id = $1;
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET
+	body = $1,
+	updated_at = now()
+WHERE id = $2
+RETURNING *;
 
 -- name: DeleteChirpByID :exec
 DELETE FROM chirps
 WHERE id = $1;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1
+AND original_id = $2
+AND kind = 'rechirp';
+
+-- name: TombstoneChirp :exec
+UPDATE chirps
+SET
+	body = '',
+	updated_at = now(),
+	deleted_at = now()
+WHERE id = $1;
+
+-- name: ChirpHasReplies :one
+SELECT EXISTS (
+	SELECT 1 FROM chirps
+	WHERE parent_id = sqlc.arg(id)::uuid
+);
+
+-- name: IncrementChirpReplyCount :exec
+UPDATE chirps
+SET reply_count = reply_count + 1
+WHERE id = $1;
+
+-- name: DecrementChirpReplyCount :exec
+UPDATE chirps
+SET reply_count = reply_count - 1
+WHERE id = $1
+AND reply_count > 0;
+
+-- name: GetChirpsPageAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetChirpsPageDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetUsersChirpsPageAsc :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+AND deleted_at IS NULL
+AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetUsersChirpsPageDesc :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+AND deleted_at IS NULL
+AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetChirpRepliesPage :many
+SELECT * FROM chirps
+WHERE parent_id = sqlc.arg(parent_id)::uuid
+AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(page_limit);
+
+-- name: GetTimelinePage :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (user_id = sqlc.arg(user_id)::uuid
+	OR user_id IN (
+		SELECT followee_id FROM follows
+		WHERE follower_id = sqlc.arg(user_id)::uuid
+	))
+AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_limit);
+
+-- name: SearchChirps :many
+SELECT
+	sqlc.embed(chirps),
+	ts_rank(search_vector, to_tsquery('english', sqlc.arg(query)::text))::real AS rank
+FROM chirps
+WHERE search_vector @@ to_tsquery('english', sqlc.arg(query)::text)
+AND deleted_at IS NULL
+AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since)::timestamp)
+AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until)::timestamp)
+AND (sqlc.narg(cursor_rank)::real IS NULL
+	OR (ts_rank(search_vector, to_tsquery('english', sqlc.arg(query)::text)), created_at, id)
+	< (sqlc.narg(cursor_rank)::real, sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg(page_limit);
@@ -0,0 +1,53 @@
+-- name: GetContentFilterTerms :many
+SELECT * FROM content_filter_terms
+ORDER BY term;
+
+-- name: UpsertContentFilterTerm :one
+INSERT INTO content_filter_terms (term, action, created_at, updated_at)
+VALUES (
+	$1,
+	$2,
+	now(),
+	now()
+)
+ON CONFLICT (term) DO UPDATE
+SET action = excluded.action,
+	updated_at = now(),
+	removed_at = NULL
+RETURNING *;
+
+-- name: RemoveContentFilterTerm :exec
+INSERT INTO content_filter_terms (term, action, created_at, updated_at, removed_at)
+VALUES (
+	$1,
+	$2,
+	now(),
+	now(),
+	now()
+)
+ON CONFLICT (term) DO UPDATE
+SET updated_at = now(),
+	removed_at = now();
+
+-- name: CreateChirpFlag :exec
+INSERT INTO chirp_flags (chirp_id, terms, created_at)
+VALUES (
+	$1,
+	$2,
+	now()
+)
+ON CONFLICT (chirp_id) DO UPDATE
+SET terms = excluded.terms;
+
+-- name: DeleteChirpFlag :exec
+DELETE FROM chirp_flags
+WHERE chirp_id = $1;
+
+-- name: GetChirpFlagsPage :many
+SELECT sqlc.embed(chirps), chirp_flags.terms, chirp_flags.created_at AS flagged_at
+FROM chirp_flags
+JOIN chirps ON chirps.id = chirp_flags.chirp_id
+WHERE (sqlc.narg(cursor_created_at)::timestamp IS NULL
+	OR (chirp_flags.created_at, chirp_flags.chirp_id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY chirp_flags.created_at DESC, chirp_flags.chirp_id DESC
+LIMIT sqlc.arg(page_limit);
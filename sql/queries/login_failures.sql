@@ -0,0 +1,39 @@
+-- name: FailLogin :one
+INSERT INTO login_failures (key, failures, last_failure_at)
+VALUES (
+	sqlc.arg(key),
+	1,
+	sqlc.arg(failed_at)::timestamp
+)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+		WHEN login_failures.last_failure_at < sqlc.arg(since)::timestamp THEN 1
+		ELSE login_failures.failures + 1
+	END,
+	last_failure_at = sqlc.arg(failed_at)::timestamp,
+	notified = login_failures.notified AND login_failures.last_failure_at >= sqlc.arg(since)::timestamp
+RETURNING *;
+
+-- name: GetLoginFailures :one
+SELECT * FROM login_failures
+WHERE key = $1;
+
+-- name: ForgiveLoginFailure :exec
+UPDATE login_failures
+SET failures = failures - 1
+WHERE key = $1
+AND failures > 0;
+
+-- name: NotifyLoginFailures :execrows
+UPDATE login_failures
+SET notified = true
+WHERE key = $1
+AND NOT notified;
+
+-- name: ResetLoginFailures :exec
+DELETE FROM login_failures
+WHERE key = $1;
+
+-- name: DeleteLoginFailuresBefore :exec
+DELETE FROM login_failures
+WHERE last_failure_at < $1;
@@ -0,0 +1,43 @@
+-- name: CreateMediaAttachment :one
+INSERT INTO media_attachments (id, user_id, content_type, width, height, size_bytes, blob_key, thumbnail_key, created_at)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	now()
+)
+RETURNING *;
+
+-- name: AttachMedia :execrows
+UPDATE media_attachments
+SET chirp_id = sqlc.arg(chirp_id)::uuid,
+	position = sqlc.arg(position)
+WHERE media_attachments.id = sqlc.arg(id)
+AND media_attachments.user_id = sqlc.arg(user_id)
+AND media_attachments.chirp_id IS NULL
+AND NOT EXISTS (
+	SELECT 1 FROM users
+	WHERE users.avatar_media_id = media_attachments.id
+);
+
+-- name: GetChirpsMedia :many
+SELECT * FROM media_attachments
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: DeleteChirpMedia :exec
+DELETE FROM media_attachments
+WHERE chirp_id = sqlc.arg(chirp_id)::uuid;
+
+-- name: GetMediaAttachmentByID :one
+SELECT * FROM media_attachments
+WHERE id = $1;
+
+-- name: DeleteMediaAttachment :exec
+DELETE FROM media_attachments
+WHERE id = $1;
@@ -0,0 +1,26 @@
+-- name: CreateMFAChallenge :exec
+INSERT INTO mfa_challenges (token_hash, user_id, created_at, expires_at)
+VALUES (
+	$1,
+	$2,
+	now(),
+	$3
+);
+
+-- name: GetMFAChallengeForUpdate :one
+SELECT * FROM mfa_challenges
+WHERE token_hash = sqlc.arg(token_hash)
+AND used_at IS NULL
+AND expires_at > sqlc.arg(now)::timestamp
+AND attempts < sqlc.arg(attempts_max)::integer
+FOR UPDATE;
+
+-- name: FailMFAChallenge :exec
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1;
+
+-- name: UseMFAChallenge :exec
+UPDATE mfa_challenges
+SET used_at = now()
+WHERE token_hash = $1;
@@ -0,0 +1,61 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes, created_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	now()
+) RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: GetOAuthClients :many
+SELECT * FROM oauth_clients
+ORDER BY created_at;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+	code_hash,
+	client_id,
+	user_id,
+	redirect_uri,
+	scopes,
+	code_challenge,
+	family_id,
+	created_at,
+	expires_at
+) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	gen_random_uuid(),
+	now(),
+	$7
+);
+
+-- name: GetOAuthAuthorizationCodeForUpdate :one
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash = $1
+FOR UPDATE;
+
+-- name: UseOAuthAuthorizationCode :exec
+UPDATE oauth_authorization_codes
+SET used_at = now()
+WHERE code_hash = $1;
+
+-- name: CountActiveRefreshTokenFamily :one
+SELECT count(*) FROM refresh_tokens
+WHERE family_id = sqlc.arg(family_id)
+AND revoked_at IS NULL
+AND expires_at > sqlc.arg(now)::timestamp;
@@ -1,29 +1,95 @@
 -- name: CreateToken :one
 INSERT INTO refresh_tokens (
-	token,
+	token_hash,
+	family_id,
+	family_created_at,
 	created_at,
 	updated_at,
+	last_used_at,
 	user_id,
 	expires_at,
-	revoked_at
+	user_agent,
+	ip,
+	client_id,
+	scopes
 ) VALUES (
 	$1,
-	now(),
-	now(),
 	$2,
 	$3,
-	$4
+	now(),
+	now(),
+	now(),
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	$9
 ) RETURNING *;
 
--- name: GetUserFromRefreshToken :one
-SELECT user_id FROM refresh_tokens
-WHERE token = $1
-AND expires_at > now()
-AND (revoked_at > now() OR revoked_at is null);
+-- name: GetRefreshTokenForUpdate :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: RotateRefreshToken :exec
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	rotated_at = now(),
+	revoked_at = now()
+WHERE token_hash = $1;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET
 	updated_at = now(),
 	revoked_at = now()
-WHERE token = $1;
+WHERE token_hash = $1
+AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	revoked_at = now()
+WHERE family_id = $1
+AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	revoked_at = now()
+WHERE user_id = $1
+AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokensExcept :exec
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	revoked_at = now()
+WHERE user_id = $1
+AND family_id <> $2
+AND revoked_at IS NULL;
+
+-- name: GetUserSessions :many
+SELECT * FROM refresh_tokens
+WHERE user_id = sqlc.arg(user_id)
+AND revoked_at IS NULL
+AND expires_at > sqlc.arg(now)::timestamp
+ORDER BY last_used_at DESC, family_id;
+
+-- name: RevokeUserSession :many
+UPDATE refresh_tokens
+SET
+	updated_at = now(),
+	revoked_at = now()
+WHERE user_id = $1
+AND family_id = $2
+AND revoked_at IS NULL
+RETURNING family_id;
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1;
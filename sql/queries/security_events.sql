@@ -0,0 +1,9 @@
+-- name: CreateSecurityEvent :exec
+INSERT INTO security_events (id, user_id, event, detail, created_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	now()
+);
@@ -0,0 +1,38 @@
+-- name: CreateSigningKey :one
+INSERT INTO signing_keys (id, algorithm, private_key, created_at, signs_at)
+VALUES (
+	$1,
+	$2,
+	$3,
+	now(),
+	$4
+) RETURNING *;
+
+-- name: GetSigningKeys :many
+SELECT * FROM signing_keys
+WHERE retires_at IS NULL
+OR retires_at > sqlc.arg(now)::timestamp
+ORDER BY signs_at DESC, created_at DESC, id;
+
+-- name: GetAllSigningKeys :many
+SELECT * FROM signing_keys;
+
+-- name: SealSigningKey :exec
+UPDATE signing_keys
+SET private_key = $2
+WHERE id = $1;
+
+-- name: RetireSigningKeys :exec
+UPDATE signing_keys
+SET retires_at = $2
+WHERE id <> $1
+AND retires_at IS NULL;
+
+-- name: GetFirstSigningKeyCreatedAt :one
+SELECT min(created_at)::timestamp AS created_at FROM signing_keys;
+
+-- name: LockSigningKeys :exec
+SELECT pg_advisory_xact_lock(hashtext('signing_keys'));
+
+-- name: CountSigningKeys :one
+SELECT count(*) FROM signing_keys;
@@ -0,0 +1,19 @@
+-- name: CreateTOTPRecoveryCode :exec
+INSERT INTO totp_recovery_codes (code_hash, user_id, created_at)
+VALUES (
+	$1,
+	$2,
+	now()
+);
+
+-- name: DeleteUserTOTPRecoveryCodes :exec
+DELETE FROM totp_recovery_codes
+WHERE user_id = $1;
+
+-- name: UseTOTPRecoveryCode :one
+UPDATE totp_recovery_codes
+SET used_at = now()
+WHERE code_hash = $1
+AND user_id = $2
+AND used_at IS NULL
+RETURNING code_hash;
@@ -1,11 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
 VALUES (
 	gen_random_uuid(),
 	now(),
 	now(),
 	$1,
-	$2
+	$2,
+	$3
 )
 RETURNING *;
 
@@ -17,14 +18,119 @@ WHERE 1=1;
 SELECT * FROM users
 WHERE email = $1;
 
--- name: UpdateUser :one
-UPDATE users
-SET email = $1,
-	hashed_password = $2
-WHERE id = $3
-RETURNING *;
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUsersByUsernames :many
+SELECT * FROM users
+WHERE lower(username) = ANY(sqlc.arg(usernames)::text[]);
 
 -- name: UpgradeUserMembership :exec
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1;
+
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE lower(username) = lower(sqlc.arg(username)::text);
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET username = coalesce(sqlc.narg(username)::text, username),
+	display_name = coalesce(sqlc.narg(display_name)::text, display_name),
+	bio = coalesce(sqlc.narg(bio)::text, bio),
+	location = coalesce(sqlc.narg(location)::text, location),
+	website = coalesce(sqlc.narg(website)::text, website),
+	updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: SetUserAvatar :one
+UPDATE users
+SET avatar_media_id = sqlc.narg(avatar_media_id)::uuid,
+	updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: UpdateUserAccount :one
+UPDATE users
+SET pending_email = CASE
+		WHEN sqlc.narg(email)::text IS NULL THEN pending_email
+		WHEN sqlc.narg(email)::text = email THEN NULL
+		ELSE sqlc.narg(email)::text
+	END,
+	hashed_password = coalesce(sqlc.narg(hashed_password)::text, hashed_password),
+	username = coalesce(sqlc.narg(username)::text, username),
+	updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = now(),
+	updated_at = now()
+WHERE id = sqlc.arg(id)
+AND email = sqlc.arg(email)
+RETURNING *;
+
+-- name: ConfirmUserPendingEmail :one
+UPDATE users
+SET email = pending_email,
+	pending_email = NULL,
+	email_verified_at = now(),
+	updated_at = now()
+WHERE id = sqlc.arg(id)
+AND pending_email = sqlc.arg(pending_email)::text
+RETURNING *;
+
+-- name: SetUserTOTPSecret :one
+UPDATE users
+SET totp_secret = sqlc.arg(totp_secret)::text,
+	updated_at = now()
+WHERE id = sqlc.arg(id)
+AND totp_enabled_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTPSecrets :many
+SELECT id, totp_secret::text AS totp_secret FROM users
+WHERE totp_secret IS NOT NULL;
+
+-- name: SealUserTOTPSecret :exec
+UPDATE users
+SET totp_secret = sqlc.arg(totp_secret_sealed)::text
+WHERE id = sqlc.arg(id)
+AND totp_secret = sqlc.arg(totp_secret)::text;
+
+-- name: EnableUserTOTP :one
+UPDATE users
+SET totp_enabled_at = now(),
+	totp_last_step = sqlc.arg(totp_last_step)::bigint,
+	updated_at = now()
+WHERE id = sqlc.arg(id)
+AND totp_secret IS NOT NULL
+AND totp_enabled_at IS NULL
+RETURNING *;
+
+-- name: UseUserTOTPStep :one
+UPDATE users
+SET totp_last_step = sqlc.arg(totp_last_step)::bigint
+WHERE id = sqlc.arg(id)
+AND totp_enabled_at IS NOT NULL
+AND (totp_last_step IS NULL OR totp_last_step < sqlc.arg(totp_last_step)::bigint)
+RETURNING id;
+
+-- name: DisableUserTOTP :one
+UPDATE users
+SET totp_secret = NULL,
+	totp_enabled_at = NULL,
+	totp_last_step = NULL,
+	updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = sqlc.arg(hashed_password)::text
+WHERE id = sqlc.arg(id)
+AND hashed_password = sqlc.arg(hashed_password_old)::text;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN username TEXT;
+
+CREATE UNIQUE INDEX users_username_idx ON users (lower(username));
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN username;
@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE content_filter_terms (
+	term TEXT PRIMARY KEY,
+	action TEXT NOT NULL CHECK (action IN ('mask', 'reject', 'flag')),
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO content_filter_terms (term, action, created_at, updated_at)
+VALUES
+	('kerfuffle', 'mask', now(), now()),
+	('sharbert', 'mask', now(), now()),
+	('fornax', 'mask', now(), now());
+
+CREATE TABLE chirp_flags (
+	chirp_id UUID PRIMARY KEY REFERENCES chirps(id) ON DELETE CASCADE,
+	terms TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX chirp_flags_created_at_idx ON chirp_flags (created_at, chirp_id);
+
+-- +goose Down
+DROP TABLE chirp_flags;
+DROP TABLE content_filter_terms;
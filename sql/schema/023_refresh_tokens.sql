@@ -0,0 +1,22 @@
+-- +goose Up
+-- A token family is a session, from the login through every refresh.
+ALTER TABLE refresh_tokens
+ADD COLUMN family_created_at TIMESTAMP,
+ADD COLUMN last_used_at TIMESTAMP,
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+
+UPDATE refresh_tokens
+SET family_created_at = created_at,
+	last_used_at = created_at;
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_created_at SET NOT NULL,
+ALTER COLUMN last_used_at SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN family_created_at,
+DROP COLUMN last_used_at,
+DROP COLUMN user_agent,
+DROP COLUMN ip;
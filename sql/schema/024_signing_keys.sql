@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE signing_keys (
+	id TEXT PRIMARY KEY,
+	algorithm TEXT NOT NULL,
+	private_key TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	retires_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE signing_keys;
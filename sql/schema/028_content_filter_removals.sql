@@ -0,0 +1,11 @@
+-- +goose Up
+-- Removed terms are kept so terms of CONTENT_FILTER_FILE stay removed.
+ALTER TABLE content_filter_terms
+ADD COLUMN removed_at TIMESTAMP;
+
+-- +goose Down
+DELETE FROM content_filter_terms
+WHERE removed_at IS NOT NULL;
+
+ALTER TABLE content_filter_terms
+DROP COLUMN removed_at;
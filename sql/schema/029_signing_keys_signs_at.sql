@@ -0,0 +1,15 @@
+-- +goose Up
+-- New keys are published a while before they sign, so every server and
+-- JWKS cache has them by the first token they sign.
+ALTER TABLE signing_keys
+ADD COLUMN signs_at TIMESTAMP;
+
+UPDATE signing_keys
+SET signs_at = created_at;
+
+ALTER TABLE signing_keys
+ALTER COLUMN signs_at SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE signing_keys
+DROP COLUMN signs_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Whether the owner was told of the lockout these failures led to, so
+-- failures stepping past the threshold at the same time tell them once.
+ALTER TABLE login_failures
+ADD COLUMN notified BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE login_failures
+DROP COLUMN notified;
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+	"github.com/el-damiano/bootdev-http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer            = "Chirpy"
+	totpRecoveryCodeCount = 10
+
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaAttemptsMax is how many wrong codes an MFA token survives, so it
+	// can't be used to guess all million codes.
+	mfaAttemptsMax = 5
+)
+
+var errMFAInvalid = errors.New("invalid or already used code")
+
+// mfaCheck checks a code from the authenticator app, or a recovery code when
+// one is given, using it up so it works only once.
+func (cfg *apiConfig) mfaCheck(qtx *database.Queries, user database.User, code, recoveryCode string) error {
+	if !user.TotpEnabledAt.Valid {
+		return errMFAInvalid
+	}
+
+	if recoveryCode != "" {
+		_, err := qtx.UseTOTPRecoveryCode(context.Background(), database.UseTOTPRecoveryCodeParams{
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+			UserID:   user.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return errMFAInvalid
+		}
+		return err
+	}
+
+	secret, err := cfg.totpSecretOpen(user)
+	if err != nil {
+		return err
+	}
+	step, err := auth.ValidateTOTP(secret, code, cfg.now(), user.TotpLastStep.Int64)
+	if err != nil {
+		return errMFAInvalid
+	}
+	_, err = qtx.UseUserTOTPStep(context.Background(), database.UseUserTOTPStepParams{
+		TotpLastStep: step,
+		ID:           user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return errMFAInvalid
+	}
+	return err
+}
+
+// totpSecretOf is what the TOTP secret of a user is sealed for, so it only
+// opens as theirs.
+func totpSecretOf(userID uuid.UUID) string {
+	return "totp secret " + userID.String()
+}
+
+// totpSecretOpen opens the TOTP secret of the user.
+func (cfg *apiConfig) totpSecretOpen(user database.User) (string, error) {
+	return openSecret(cfg.secrets, user.TotpSecret.String, totpSecretOf(user.ID))
+}
+
+// sealTOTPSecrets seals the TOTP secrets stored in the clear by versions
+// from before they were sealed.
+func (cfg *apiConfig) sealTOTPSecrets() error {
+	rows, err := cfg.dbQueries.GetUserTOTPSecrets(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if auth.IsSealed(row.TotpSecret) {
+			continue
+		}
+		secretSealed, err := cfg.secrets.Seal(row.TotpSecret, totpSecretOf(row.ID))
+		if err != nil {
+			return err
+		}
+		err = cfg.dbQueries.SealUserTOTPSecret(context.Background(), database.SealUserTOTPSecretParams{
+			TotpSecretSealed: secretSealed,
+			ID:               row.ID,
+			TotpSecret:       row.TotpSecret,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// totpRecoveryCodesReplace makes a fresh set of recovery codes, dropping the
+// old ones. Only hashes are stored, the codes are shown to the user once.
+func totpRecoveryCodesReplace(qtx *database.Queries, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.MakeRecoveryCodes(totpRecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = qtx.DeleteUserTOTPRecoveryCodes(context.Background(), userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		err = qtx.CreateTOTPRecoveryCode(context.Background(), database.CreateTOTPRecoveryCodeParams{
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+			UserID:   userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// userReauthenticate loads the user and checks their current password, for
+// changes a stolen access token alone shouldn't allow. It responds itself
+// when it fails.
+func (cfg *apiConfig) userReauthenticate(w http.ResponseWriter, r *http.Request, currentPassword string) (database.User, bool) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return database.User{}, false
+	}
+	if currentPassword == "" {
+		respondWithValidationErrors(w, validationErrors{"current_password": errors.New("current_password is required")})
+		return database.User{}, false
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(context.Background(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: user not found", err)
+		return database.User{}, false
+	}
+	if !cfg.currentPasswordCheck(w, r, user, currentPassword) {
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// totpEnrollHandler starts setting up two-factor authentication with a new
+// secret. It isn't required at login until confirmed with totpConfirmHandler.
+func (cfg *apiConfig) totpEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	user, ok := cfg.userReauthenticate(w, r, params.CurrentPassword)
+	if !ok {
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret, err := auth.MakeTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enrolling two-factor authentication", err)
+		return
+	}
+
+	secretSealed, err := cfg.secrets.Seal(secret, totpSecretOf(user.ID))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enrolling two-factor authentication", err)
+		return
+	}
+
+	_, err = cfg.dbQueries.SetUserTOTPSecret(context.Background(), database.SetUserTOTPSecretParams{
+		TotpSecret: secretSealed,
+		ID:         user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enrolling two-factor authentication", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// totpConfirmHandler enables two-factor authentication once the user proves
+// their app has the secret, and hands out recovery codes.
+func (cfg *apiConfig) totpConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: invalid/expired JWT", err)
+		return
+	}
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(context.Background(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authorization failed: user not found", err)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication enrollment hasn't started", nil)
+		return
+	}
+
+	secret, err := cfg.totpSecretOpen(user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enabling two-factor authentication", err)
+		return
+	}
+	step, err := auth.ValidateTOTP(secret, params.Code, cfg.now(), 0)
+	if err != nil {
+		respondWithValidationErrors(w, validationErrors{"code": errors.New("code doesn't match the authenticator app")})
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enabling two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	_, err = qtx.EnableUserTOTP(context.Background(), database.EnableUserTOTPParams{
+		TotpLastStep: step,
+		ID:           user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enabling two-factor authentication", err)
+		return
+	}
+
+	codes, err := totpRecoveryCodesReplace(qtx, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enabling two-factor authentication", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enabling two-factor authentication", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	})
+}
+
+func (cfg *apiConfig) totpRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	user, ok := cfg.userReauthenticate(w, r, params.CurrentPassword)
+	if !ok {
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication isn't enabled", nil)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error making recovery codes", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	codes, err := totpRecoveryCodesReplace(qtx, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error making recovery codes", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error making recovery codes", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	})
+}
+
+// totpDisableHandler turns two-factor authentication off, which takes both
+// the password and a code.
+func (cfg *apiConfig) totpDisableHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+		RecoveryCode    string `json:"recovery_code"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	user, ok := cfg.userReauthenticate(w, r, params.CurrentPassword)
+	if !ok {
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication isn't enabled", nil)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error disabling two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = cfg.mfaCheck(qtx, user, params.Code, params.RecoveryCode)
+	if errors.Is(err, errMFAInvalid) {
+		respondWithError(w, http.StatusForbidden, "Incorrect two-factor authentication code", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error disabling two-factor authentication", err)
+		return
+	}
+
+	user, err = qtx.DisableUserTOTP(context.Background(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error disabling two-factor authentication", err)
+		return
+	}
+	err = qtx.DeleteUserTOTPRecoveryCodes(context.Background(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error disabling two-factor authentication", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error disabling two-factor authentication", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, userFromDB(user))
+}
+
+// mfaChallengeRespond answers a correct password of a user with two-factor
+// authentication with a short-lived token to submit alongside their code.
+func (cfg *apiConfig) mfaChallengeRespond(w http.ResponseWriter, user database.User) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error making MFA token", err)
+		return
+	}
+
+	err = cfg.dbQueries.CreateMFAChallenge(context.Background(), database.CreateMFAChallengeParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: cfg.now().UTC().Add(mfaChallengeTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error making MFA token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}{
+		MFARequired: true,
+		MFAToken:    token,
+	})
+}
+
+// loginMFAHandler finishes logging in with the token from userLoginHandler
+// and a code from the authenticator app or a recovery code.
+func (cfg *apiConfig) loginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding request", err)
+		return
+	}
+
+	errs := validationErrors{}
+	if params.MFAToken == "" {
+		errs.add("mfa_token", errors.New("mfa_token is required"))
+	}
+	if params.Code == "" && params.RecoveryCode == "" {
+		errs.add("code", errors.New("code or recovery_code is required"))
+	}
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, errs)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	challenge, err := qtx.GetMFAChallengeForUpdate(context.Background(), database.GetMFAChallengeForUpdateParams{
+		TokenHash:   auth.HashToken(params.MFAToken),
+		Now:         cfg.now().UTC(),
+		AttemptsMax: mfaAttemptsMax,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "MFA token is invalid or expired, log in again", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+		return
+	}
+
+	user, err := qtx.GetUserByID(context.Background(), challenge.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+		return
+	}
+
+	wait, err := cfg.loginAttempt(r, user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+		return
+	}
+	if wait > 0 {
+		respondWithLoginThrottled(w, wait)
+		return
+	}
+
+	err = cfg.mfaCheck(qtx, user, params.Code, params.RecoveryCode)
+	if errors.Is(err, errMFAInvalid) {
+		cfg.loginFailed(r, user.Email, &user)
+		err = qtx.FailMFAChallenge(context.Background(), challenge.TokenHash)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, "Incorrect two-factor authentication code", errMFAInvalid)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+		return
+	}
+
+	err = qtx.UseMFAChallenge(context.Background(), challenge.TokenHash)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error logging in", err)
+		return
+	}
+
+	cfg.userLoginRespond(w, r, user)
+}
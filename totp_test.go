@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+)
+
+// totpEnable turns on two-factor authentication for the logged in user,
+// returning the secret of their app and their recovery codes.
+func (api *testAPI) totpEnable(t *testing.T, user User) (string, []string) {
+	t.Helper()
+	res := api.request(t, "POST", "/api/users/me/totp", bearer(user.Token), map[string]string{"current_password": testPassword})
+	if res.code != http.StatusOK {
+		t.Fatalf("POST /api/users/me/totp got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+	enrollment := struct {
+		Secret string `json:"secret"`
+	}{}
+	res.decode(t, &enrollment)
+
+	res = api.request(t, "POST", "/api/users/me/totp/confirm", bearer(user.Token), map[string]string{"code": api.totpCode(t, enrollment.Secret)})
+	if res.code != http.StatusOK {
+		t.Fatalf("POST /api/users/me/totp/confirm got %d %s, want %d", res.code, res.body, http.StatusOK)
+	}
+	recovery := struct {
+		Codes []string `json:"recovery_codes"`
+	}{}
+	res.decode(t, &recovery)
+	return enrollment.Secret, recovery.Codes
+}
+
+// totpCode is the code the app shows right now. A code works only once, move
+// the clock by auth.TOTPPeriod before asking for the next one.
+func (api *testAPI) totpCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := auth.TOTPCode(secret, api.clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestLoginMFAHandler(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	email := api.userCreate(t)
+	secret, recoveryCodes := api.totpEnable(t, api.login(t, email, testPassword))
+
+	cases := map[string]struct {
+		// wait is how long the user takes to type the code
+		wait time.Duration
+		// body returns the code to finish logging in with
+		body       func() map[string]string
+		wantCode   int
+		wantFields []string
+	}{
+		"app code": {
+			body:     func() map[string]string { return map[string]string{"code": api.totpCode(t, secret)} },
+			wantCode: http.StatusOK,
+		},
+		"recovery code": {
+			body:     func() map[string]string { return map[string]string{"recovery_code": recoveryCodes[0]} },
+			wantCode: http.StatusOK,
+		},
+		"app code just before the challenge expires": {
+			wait:     mfaChallengeTTL - time.Second,
+			body:     func() map[string]string { return map[string]string{"code": api.totpCode(t, secret)} },
+			wantCode: http.StatusOK,
+		},
+		"expired challenge": {
+			wait:     mfaChallengeTTL,
+			body:     func() map[string]string { return map[string]string{"code": api.totpCode(t, secret)} },
+			wantCode: http.StatusUnauthorized,
+		},
+		"wrong app code": {
+			body:     func() map[string]string { return map[string]string{"code": "000000"} },
+			wantCode: http.StatusUnauthorized,
+		},
+		"no code": {
+			body:       func() map[string]string { return map[string]string{} },
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"code"},
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("Test case %v", i), func(t *testing.T) {
+			// a code of the app works once
+			api.clock.Add(auth.TOTPPeriod)
+			res := api.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": testPassword})
+			if res.code != http.StatusOK {
+				t.Fatalf("POST /api/login got %d %s, want %d", res.code, res.body, http.StatusOK)
+			}
+			challenge := struct {
+				MFAToken string `json:"mfa_token"`
+			}{}
+			res.decode(t, &challenge)
+			if challenge.MFAToken == "" {
+				t.Fatalf("POST /api/login got %s, want an MFA token", res.body)
+			}
+
+			api.clock.Add(c.wait)
+			body := c.body()
+			body["mfa_token"] = challenge.MFAToken
+			res = api.request(t, "POST", "/api/login/mfa", "", body)
+			if res.code != c.wantCode {
+				t.Fatalf("POST /api/login/mfa got %d %s, want %d", res.code, res.body, c.wantCode)
+			}
+			for _, field := range c.wantFields {
+				if _, ok := res.fields(t)[field]; !ok {
+					t.Errorf("POST /api/login/mfa got %s, want %s to fail validation", res.body, field)
+				}
+			}
+			if res.code != http.StatusOK {
+				return
+			}
+
+			user := User{}
+			res.decode(t, &user)
+			if user.Token == "" || user.TokenRefresh == "" {
+				t.Errorf("POST /api/login/mfa got %s, want tokens", res.body)
+			}
+		})
+	}
+}
+
+func TestTOTPSecretSealed(t *testing.T) {
+	api := newTestAPI(t, testDB(t))
+	email := api.userCreate(t)
+	secret, _ := api.totpEnable(t, api.login(t, email, testPassword))
+
+	stored := func() string {
+		t.Helper()
+		value := ""
+		err := api.cfg.db.QueryRow("SELECT totp_secret FROM users WHERE email = $1", email).Scan(&value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	loginMFA := func() {
+		t.Helper()
+		api.clock.Add(auth.TOTPPeriod)
+		res := api.request(t, "POST", "/api/login", "", map[string]string{"email": email, "password": testPassword})
+		challenge := struct {
+			MFAToken string `json:"mfa_token"`
+		}{}
+		res.decode(t, &challenge)
+		res = api.request(t, "POST", "/api/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": api.totpCode(t, secret)})
+		if res.code != http.StatusOK {
+			t.Fatalf("POST /api/login/mfa got %d %s, want %d", res.code, res.body, http.StatusOK)
+		}
+	}
+
+	if value := stored(); !auth.IsSealed(value) || strings.Contains(value, secret) {
+		t.Fatalf("TOTP secret stored as %q, want it sealed", value)
+	}
+	loginMFA()
+
+	// a secret stored in the clear before secrets were sealed
+	_, err := api.cfg.db.Exec("UPDATE users SET totp_secret = $1 WHERE email = $2", secret, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginMFA()
+
+	err = api.cfg.sealTOTPSecrets()
+	if err != nil {
+		t.Fatalf("sealTOTPSecrets() error = %v", err)
+	}
+	if value := stored(); !auth.IsSealed(value) || strings.Contains(value, secret) {
+		t.Fatalf("TOTP secret stored as %q after sealing, want it sealed", value)
+	}
+	loginMFA()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/el-damiano/bootdev-http-server/internal/auth"
+)
+
+// validationErrors maps request fields to what is wrong with them.
+type validationErrors map[string]error
+
+func (v validationErrors) add(field string, err error) {
+	if err != nil {
+		v[field] = err
+	}
+}
+
+// respondWithValidationErrors lists what is wrong with every field. Fields
+// breaking several rules, like passwords, list the rules as well, for clients
+// to point out each one.
+func respondWithValidationErrors(w http.ResponseWriter, errs validationErrors) {
+	type errorResponse struct {
+		Error  string                              `json:"error"`
+		Fields map[string]string                   `json:"fields"`
+		Rules  map[string][]auth.PasswordViolation `json:"rules,omitempty"`
+	}
+
+	response := errorResponse{
+		Error:  "Validation failed",
+		Fields: map[string]string{},
+	}
+	for field, err := range errs {
+		response.Fields[field] = err.Error()
+
+		policyErr := &auth.PasswordPolicyError{}
+		if errors.As(err, &policyErr) {
+			if response.Rules == nil {
+				response.Rules = map[string][]auth.PasswordViolation{}
+			}
+			response.Rules[field] = policyErr.Violations
+		}
+	}
+	respondWithJSON(w, http.StatusUnprocessableEntity, response)
+}
+
+// emailParam validates an email address. Only a bare address is accepted,
+// "John <john@example.com>" is not.
+func emailParam(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", errors.New("email is required")
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", errors.New("email must be a valid email address")
+	}
+	return email, nil
+}
+
+// passwordParam checks a new password of the account with the email
+// against the password policy.
+func (cfg *apiConfig) passwordParam(password, email string) error {
+	return cfg.passwordPolicy.Check(password, email)
+}